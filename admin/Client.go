@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// Send sends a command to the admin socket and returns its output
+func Send(path string, args []string) (string, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return "", ErrorConnect(path, err)
+	}
+	defer conn.Close()
+	if _, err = io.WriteString(conn, strings.Join(args, " ")+"\n"); err != nil {
+		return "", ErrorConnect(path, err)
+	}
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return "", ErrorConnect(path, err)
+	}
+	status = strings.TrimSuffix(status, "\n")
+	if status != "ok" {
+		return "", ErrorCommandFailed(strings.TrimPrefix(status, "error "))
+	}
+	out, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", ErrorConnect(path, err)
+	}
+	return string(out), nil
+}
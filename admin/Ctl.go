@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// ctlUsage describes the commands that the control client can send
+const ctlUsage = `Usage: %s ctl [options...] command [arguments...]
+
+Options:
+    -h, --help                  Prints this help text to the console and exits
+    -s, --socket [value]        Connects to the admin socket at the given path (default %s)
+
+Commands:
+    list                        Lists the services, listeners and open connections
+    kill [id]                   Closes the connection or flow with the given ID
+    pause [address]             Stops a listener from accepting new connections
+    resume [address]            Lets a paused listener accept connections again
+    config                      Prints the configuration that is running
+    bans                        Lists the networks that are banned
+    ban [network] [duration]    Bans an address or CIDR network, for the given duration or forever
+    unban [network]             Lifts the ban on an address or CIDR network
+`
+
+// Ctl runs the control client with the arguments that follow "ctl" on the command line and returns the exit code
+func Ctl(program string, args []string, stdout io.Writer, stderr io.Writer) int {
+	path := config.DefaultAdminSocket
+	for len(args) > 0 {
+		switch args[0] {
+		case "-s", "--socket":
+			if len(args) < 2 {
+				fmt.Fprintf(stderr, "Flag '%s' requires an argument\n\n", args[0])
+				fmt.Fprintf(stderr, ctlUsage, program, config.DefaultAdminSocket)
+				return 1
+			}
+			path = args[1]
+			args = args[2:]
+			continue
+		case "-h", "--help":
+			fmt.Fprintf(stdout, ctlUsage, program, config.DefaultAdminSocket)
+			return 0
+		}
+		break
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, ctlUsage, program, config.DefaultAdminSocket)
+		return 1
+	}
+	out, err := Send(path, args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	io.WriteString(stdout, out)
+	return 0
+}
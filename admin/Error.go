@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"fmt"
+)
+
+// ErrorCode describes a specific error
+type ErrorCode int
+
+const (
+	// ErrorCodeListenStart represents when the admin socket could not be created
+	ErrorCodeListenStart ErrorCode = iota
+	// ErrorCodeSocketInUse represents when another instance is already serving the admin socket
+	ErrorCodeSocketInUse ErrorCode = iota
+	// ErrorCodeConnect represents when the control client could not reach the admin socket
+	ErrorCodeConnect ErrorCode = iota
+	// ErrorCodeUnknownCommand represents when a command is sent that the admin socket does not understand
+	ErrorCodeUnknownCommand ErrorCode = iota
+	// ErrorCodeUsage represents when a command is given the wrong arguments
+	ErrorCodeUsage ErrorCode = iota
+	// ErrorCodeUnknownConnection represents when a command names a connection that is not open
+	ErrorCodeUnknownConnection ErrorCode = iota
+	// ErrorCodeUnknownListener represents when a command names a listener that does not exist
+	ErrorCodeUnknownListener ErrorCode = iota
+	// ErrorCodeCommandFailed represents when the admin socket reports that a command failed
+	ErrorCodeCommandFailed ErrorCode = iota
+	// ErrorCodeInvalidArgument represents when an argument to a command cannot be parsed
+	ErrorCodeInvalidArgument ErrorCode = iota
+	// ErrorCodeNotBanned represents when a command tries to lift a ban that does not exist
+	ErrorCodeNotBanned ErrorCode = iota
+)
+
+// Error describes an error with the admin socket
+type Error struct {
+	Message string
+	Code    ErrorCode
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// ErrorListenStart creates a new ErrorListenStart error
+func ErrorListenStart(path string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to create admin socket %s: %s", path, err),
+		Code:    ErrorCodeListenStart,
+	}
+}
+
+// ErrorSocketInUse creates a new ErrorSocketInUse error
+func ErrorSocketInUse(path string) error {
+	return &Error{
+		Message: fmt.Sprintf("Admin socket %s is already in use by another process", path),
+		Code:    ErrorCodeSocketInUse,
+	}
+}
+
+// ErrorConnect creates a new ErrorConnect error
+func ErrorConnect(path string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to connect to admin socket %s: %s", path, err),
+		Code:    ErrorCodeConnect,
+	}
+}
+
+// ErrorUnknownCommand creates a new ErrorUnknownCommand error
+func ErrorUnknownCommand(name string) error {
+	return &Error{
+		Message: fmt.Sprintf("Unknown command '%s'", name),
+		Code:    ErrorCodeUnknownCommand,
+	}
+}
+
+// ErrorUsage creates a new ErrorUsage error
+func ErrorUsage(usage string) error {
+	return &Error{
+		Message: fmt.Sprintf("Usage: %s", usage),
+		Code:    ErrorCodeUsage,
+	}
+}
+
+// ErrorUnknownConnection creates a new ErrorUnknownConnection error
+func ErrorUnknownConnection(id string) error {
+	return &Error{
+		Message: fmt.Sprintf("No open connection has the ID '%s'", id),
+		Code:    ErrorCodeUnknownConnection,
+	}
+}
+
+// ErrorUnknownListener creates a new ErrorUnknownListener error
+func ErrorUnknownListener(addr string) error {
+	return &Error{
+		Message: fmt.Sprintf("No listener is bound to '%s'", addr),
+		Code:    ErrorCodeUnknownListener,
+	}
+}
+
+// ErrorCommandFailed creates a new ErrorCommandFailed error
+func ErrorCommandFailed(message string) error {
+	return &Error{
+		Message: message,
+		Code:    ErrorCodeCommandFailed,
+	}
+}
+
+// ErrorInvalidArgument creates a new ErrorInvalidArgument error
+func ErrorInvalidArgument(name, value string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Invalid %s '%s': %s", name, value, err),
+		Code:    ErrorCodeInvalidArgument,
+	}
+}
+
+// ErrorNotBanned creates a new ErrorNotBanned error
+func ErrorNotBanned(network string) error {
+	return &Error{
+		Message: fmt.Sprintf("%s is not banned", network),
+		Code:    ErrorCodeNotBanned,
+	}
+}
@@ -0,0 +1,9 @@
+package admin
+
+import "io"
+
+// Handler runs the commands that are sent to the admin socket
+type Handler interface {
+	// Command runs one command, writing its output to out
+	Command(args []string, out io.Writer) error
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout is how long a client has to send its command
+const requestTimeout = 5 * time.Second
+
+// Server accepts commands on a Unix-domain socket
+type Server struct {
+	Path      string
+	Socket    net.Listener
+	Handler   Handler
+	WaitGroup sync.WaitGroup
+}
+
+// CreateServer creates a new Server and starts listening
+func CreateServer(path string, handler Handler) (*Server, error) {
+	if _, err := os.Stat(path); err == nil {
+		// A socket that nobody answers on was left behind by an instance that did not exit cleanly
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, ErrorSocketInUse(path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, ErrorListenStart(path, err)
+		}
+	}
+	l, err := listen(path)
+	if err != nil {
+		return nil, ErrorListenStart(path, err)
+	}
+	return &Server{
+		Path:    path,
+		Socket:  l,
+		Handler: handler,
+	}, nil
+}
+
+// listen creates the socket in a directory that only this user can use, then moves it into place once nobody else can connect to it
+//
+// Anybody who can reach the socket can kill connections, so it must never be open to them, even for a moment.
+func listen(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".protomux")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "admin.sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed by Stop, since it is no longer at the path that the listener was opened on
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = os.Chmod(tmp, 0600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Start accepting commands
+func (s *Server) Start() {
+	s.WaitGroup.Add(1)
+	go func() {
+		defer s.WaitGroup.Done()
+		for {
+			conn, err := s.Socket.Accept()
+			if err != nil {
+				return
+			}
+			// Commands are not waited for, since they may need the locks of whoever is stopping the Server
+			go s.serve(conn)
+		}
+	}()
+}
+
+// serve runs the single command that a client sends and writes back the result
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	out := bytes.Buffer{}
+	if err := s.Handler.Command(strings.Fields(line), &out); err != nil {
+		fmt.Fprintf(conn, "error %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+	fmt.Fprintf(conn, "ok\n")
+	out.WriteTo(conn)
+}
+
+// Stop accepting commands and remove the socket
+func (s *Server) Stop() {
+	s.Socket.Close()
+	os.Remove(s.Path)
+	s.WaitGroup.Wait()
+}
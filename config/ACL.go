@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// aclParams are the parameters that make up an ACL
+var aclParams = []string{"acl", "allow", "deny"}
+
+// ACLRule allows or denies the clients in a network
+type ACLRule struct {
+	Allow   bool
+	Network *net.IPNet
+}
+
+// ACL decides which clients are allowed by the first ACLRule that contains them
+type ACL struct {
+	Rules []ACLRule
+}
+
+// parseACL parses the acl parameter, or the allow and deny parameters, into an ACL
+//
+// The acl parameter lists rules like "allow 10.0.0.0/8" in the order they are checked, so allow and deny rules can be interleaved.
+// The allow and deny parameters are a shorthand for when all of the rules of one kind come first, in the order the parameters were written.
+func parseACL(params Parameters) (ACL, error) {
+	acl := ACL{
+		Rules: []ACLRule{},
+	}
+	names := []string{}
+	for _, k := range aclParams {
+		if _, ok := params.Strings[k]; ok {
+			names = append(names, k)
+		} else if _, ok := params.Locations[k]; ok {
+			return acl, ErrorNotNetworks(k, params.Locations[k])
+		}
+	}
+	if len(names) > 1 && names[0] == "acl" {
+		return acl, ErrorConflictingParams(names[0], names[1], params.Locations[names[0]], params.Locations[names[1]])
+	}
+	if len(names) == 2 {
+		first, second := params.Locations[names[0]], params.Locations[names[1]]
+		if second.LineNo < first.LineNo || (second.LineNo == first.LineNo && second.CharStart < first.CharStart) {
+			names[0], names[1] = names[1], names[0]
+		}
+	}
+	for _, k := range names {
+		for _, v := range params.Strings[k] {
+			kind, network := k, v
+			if k == "acl" {
+				fields := strings.Fields(v)
+				if len(fields) != 2 || (fields[0] != "allow" && fields[0] != "deny") {
+					return acl, ErrorInvalidRule(k, v, params.Locations[k])
+				}
+				kind, network = fields[0], fields[1]
+			}
+			networks, err := parseRuleNetworks(network)
+			if err != nil {
+				return acl, ErrorInvalidNetwork(k, network, params.Locations[k])
+			}
+			for _, n := range networks {
+				acl.Rules = append(acl.Rules, ACLRule{
+					Allow:   kind == "allow",
+					Network: n,
+				})
+			}
+		}
+	}
+	return acl, nil
+}
+
+// parseRuleNetworks parses the networks that an ACLRule applies to, where "all" is every IPv4 and IPv6 address
+func parseRuleNetworks(value string) ([]*net.IPNet, error) {
+	if value == "all" {
+		_, v4, _ := net.ParseCIDR("0.0.0.0/0")
+		_, v6, _ := net.ParseCIDR("::/0")
+		return []*net.IPNet{v4, v6}, nil
+	}
+	network, err := ParseNetwork(value)
+	if err != nil {
+		return nil, err
+	}
+	return []*net.IPNet{network}, nil
+}
+
+// IsEmpty determines if the ACL allows every client
+func (a ACL) IsEmpty() bool {
+	return len(a.Rules) == 0
+}
+
+// Then creates an ACL that checks this ACL's rules before the rules of another
+func (a ACL) Then(next ACL) ACL {
+	return ACL{
+		Rules: append(append([]ACLRule{}, a.Rules...), next.Rules...),
+	}
+}
+
+// Check determines if a client is allowed, which it is by default unless the ACL has any allow rules
+func (a ACL) Check(ip net.IP) bool {
+	allowRules := false
+	for _, rule := range a.Rules {
+		if rule.Network.Contains(ip) {
+			return rule.Allow
+		}
+		allowRules = allowRules || rule.Allow
+	}
+	return !allowRules
+}
+
+func (a ACL) String() string {
+	rules := make([]string, len(a.Rules))
+	for i, rule := range a.Rules {
+		if rule.Allow {
+			rules[i] = fmt.Sprintf("allow %s", rule.Network)
+		} else {
+			rules[i] = fmt.Sprintf("deny %s", rule.Network)
+		}
+	}
+	return strings.Join(rules, ", ")
+}
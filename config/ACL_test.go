@@ -0,0 +1,120 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/zachdeibert/protomux/config/common"
+)
+
+// aclParameters creates Parameters holding string lists that were written on the given lines
+func aclParameters(values map[string][]string, lines map[string]int) Parameters {
+	params := Parameters{
+		Strings:     map[string][]string{},
+		Connections: map[string][]Connection{},
+		Booleans:    map[string][]bool{},
+		Integers:    map[string][]int{},
+		Locations:   map[string]common.Location{},
+	}
+	for k, v := range values {
+		params.Strings[k] = v
+		params.Locations[k] = common.Location{
+			LineNo: lines[k],
+		}
+	}
+	return params
+}
+
+func TestParseACL(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string][]string
+		lines  map[string]int
+		want   string
+		code   ErrorCode
+	}{
+		{"empty", map[string][]string{}, nil, "", -1},
+		{"allow", map[string][]string{"allow": {"10.0.0.0/8", "192.168.1.1"}}, nil, "allow 10.0.0.0/8, allow 192.168.1.1/32", -1},
+		{"deny all", map[string][]string{"deny": {"all"}}, nil, "deny 0.0.0.0/0, deny ::/0", -1},
+		{"allow then deny", map[string][]string{"allow": {"10.0.0.0/8"}, "deny": {"all"}}, map[string]int{"allow": 1, "deny": 2}, "allow 10.0.0.0/8, deny 0.0.0.0/0, deny ::/0", -1},
+		{"deny then allow", map[string][]string{"allow": {"10.0.0.0/8"}, "deny": {"10.1.0.0/16"}}, map[string]int{"allow": 2, "deny": 1}, "deny 10.1.0.0/16, allow 10.0.0.0/8", -1},
+		{"interleaved", map[string][]string{"acl": {"deny 10.1.0.0/16", "allow 10.0.0.0/8", "deny 2001:db8::/32", "allow all"}}, nil, "deny 10.1.0.0/16, allow 10.0.0.0/8, deny 2001:db8::/32, allow 0.0.0.0/0, allow ::/0", -1},
+		{"extra spaces", map[string][]string{"acl": {"  allow   10.0.0.0/8 "}}, nil, "allow 10.0.0.0/8", -1},
+		{"acl with allow", map[string][]string{"acl": {"allow all"}, "allow": {"10.0.0.0/8"}}, nil, "", ErrorCodeConflictingParams},
+		{"acl with deny", map[string][]string{"acl": {"allow all"}, "deny": {"10.0.0.0/8"}}, nil, "", ErrorCodeConflictingParams},
+		{"rule without action", map[string][]string{"acl": {"10.0.0.0/8"}}, nil, "", ErrorCodeInvalidRule},
+		{"unknown action", map[string][]string{"acl": {"permit 10.0.0.0/8"}}, nil, "", ErrorCodeInvalidRule},
+		{"too many fields", map[string][]string{"acl": {"allow 10.0.0.0/8 10.1.0.0/16"}}, nil, "", ErrorCodeInvalidRule},
+		{"bad rule network", map[string][]string{"acl": {"allow 10.0.0.0/33"}}, nil, "", ErrorCodeInvalidNetwork},
+		{"bad network", map[string][]string{"deny": {"example.com"}}, nil, "", ErrorCodeInvalidNetwork},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			acl, err := parseACL(aclParameters(test.values, test.lines))
+			if test.code >= 0 {
+				if e, ok := err.(*Error); !ok || e.Code != test.code {
+					t.Fatalf("parseACL() error = %v, want code %d", err, test.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseACL() error = %v", err)
+			}
+			if got := acl.String(); got != test.want {
+				t.Errorf("parseACL() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseACLNotNetworks(t *testing.T) {
+	params := aclParameters(nil, nil)
+	params.Integers["allow"] = []int{10}
+	params.Locations["allow"] = common.Location{}
+	if _, err := parseACL(params); err == nil || err.(*Error).Code != ErrorCodeNotNetworks {
+		t.Fatalf("parseACL() error = %v, want code %d", err, ErrorCodeNotNetworks)
+	}
+}
+
+func TestACLCheck(t *testing.T) {
+	office, err := parseACL(aclParameters(map[string][]string{"acl": {"deny 10.1.0.0/16", "allow 10.0.0.0/8", "allow 2001:db8::/32"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := parseACL(aclParameters(map[string][]string{"deny": {"192.0.2.0/24"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := parseACL(aclParameters(map[string][]string{"deny": {"all"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		acl  ACL
+		ip   string
+		want bool
+	}{
+		{"empty allows", ACL{}, "203.0.113.1", true},
+		{"first match allows", office, "10.2.3.4", true},
+		{"earlier deny wins", office, "10.1.2.3", false},
+		{"ipv6 allowed", office, "2001:db8::1", true},
+		{"unmatched with allow rules", office, "203.0.113.1", false},
+		{"unmatched ipv6 with allow rules", office, "2001:db9::1", false},
+		{"deny only", blocked, "192.0.2.10", false},
+		{"unmatched with deny only", blocked, "203.0.113.1", true},
+		{"deny all v4", closed, "127.0.0.1", false},
+		{"deny all v6", closed, "::1", false},
+		{"mapped ipv4", office, "::ffff:10.2.3.4", true},
+		{"remote rules first", blocked.Then(office), "192.0.2.10", false},
+		{"protocol rules after", blocked.Then(office), "10.2.3.4", true},
+		{"allow rules of either", blocked.Then(office), "203.0.113.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.acl.Check(net.ParseIP(test.ip)); got != test.want {
+				t.Errorf("Check(%s) = %t, want %t", test.ip, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zachdeibert/protomux/config/ast"
+)
+
+// DefaultAdminSocket is where the admin socket is created when the admin block does not say otherwise
+const DefaultAdminSocket = "/run/protomux.sock"
+
+// Admin represents where the admin control socket listens
+type Admin struct {
+	Socket string
+}
+
+// ParseAdmin parses a Block into an Admin
+func ParseAdmin(block ast.Block) (*Admin, error) {
+	if len(block.Children.Blocks) > 0 {
+		return nil, ErrorUnknownBlock(block.Children.Blocks[0].Name, "Admin", block.Children.Blocks[0].Location)
+	}
+	admin := &Admin{
+		Socket: DefaultAdminSocket,
+	}
+	params, err := ParseParameters(block.Children.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range params.Strings {
+		switch k {
+		case "socket":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "Admin", params.Locations[k])
+			}
+			admin.Socket = v[0]
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "Admin", params.Locations[k])
+		}
+	}
+	for k := range params.Connections {
+		return nil, ErrorUnknownParam(k, "Admin", params.Locations[k])
+	}
+	for k := range params.Booleans {
+		return nil, ErrorUnknownParam(k, "Admin", params.Locations[k])
+	}
+	for k := range params.Integers {
+		return nil, ErrorUnknownParam(k, "Admin", params.Locations[k])
+	}
+	return admin, nil
+}
+
+func (a Admin) String() string {
+	return fmt.Sprintf("Admin on %s", a.Socket)
+}
@@ -0,0 +1,15 @@
+package config
+
+import "github.com/zachdeibert/protomux/config/common"
+
+func parseChoice(name, objType string, vals []string, choices []string, location common.Location) (string, error) {
+	if len(vals) != 1 {
+		return "", ErrorMultipleValues(name, objType, location)
+	}
+	for _, choice := range choices {
+		if vals[0] == choice {
+			return choice, nil
+		}
+	}
+	return "", ErrorInvalidChoice(name, vals[0], choices, location)
+}
@@ -3,14 +3,21 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/zachdeibert/protomux/config/ast"
 )
 
 // Config contains the configuration for the protomux instance
 type Config struct {
-	Includes []string
-	ShowHelp bool
+	Includes      []string
+	ShowHelp      bool
+	ShutdownGrace time.Duration
+	// BanFile is where the ban list is saved so that it survives restarts, or empty to keep it in memory
+	BanFile  string
+	Log      Log
+	Metrics  *Metrics
+	Admin    *Admin
 	Services []Service
 }
 
@@ -21,15 +28,31 @@ func ParseConfig(tree ast.AST) (*Config, error) {
 		return nil, err
 	}
 	cfg := &Config{
-		Includes: []string{},
-		Services: make([]Service, len(tree.Blocks)),
-		ShowHelp: false,
+		Includes:      []string{},
+		Services:      []Service{},
+		ShowHelp:      false,
+		ShutdownGrace: 0,
+		BanFile:       "",
+		Log:           DefaultLog,
+		Metrics:       nil,
+		Admin:         nil,
 	}
 	for k, v := range params.Strings {
 		switch k {
 		case "include":
 			cfg.Includes = v
 			break
+		case "shutdownGrace":
+			if cfg.ShutdownGrace, err = parseDuration(k, "Config", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "banFile":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "Config", params.Locations[k])
+			}
+			cfg.BanFile = v[0]
+			break
 		default:
 			return nil, ErrorUnknownParam(k, "Config", params.Locations[k])
 		}
@@ -51,22 +74,78 @@ func ParseConfig(tree ast.AST) (*Config, error) {
 			return nil, ErrorUnknownParam(k, "Config", params.Locations[k])
 		}
 	}
-	for i, b := range tree.Blocks {
-		if b.Name != "service" {
+	for k := range params.Integers {
+		return nil, ErrorUnknownParam(k, "Config", params.Locations[k])
+	}
+	for _, b := range tree.Blocks {
+		switch b.Name {
+		case "service":
+			srv, err := ParseService(b)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Services = append(cfg.Services, *srv)
+			break
+		case "log":
+			log, err := ParseLog(b)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Log = *log
+			break
+		case "metrics":
+			if cfg.Metrics, err = ParseMetrics(b); err != nil {
+				return nil, err
+			}
+			break
+		case "admin":
+			if cfg.Admin, err = ParseAdmin(b); err != nil {
+				return nil, err
+			}
+			break
+		default:
 			return nil, ErrorUnknownBlock(b.Name, "Config", b.Location)
 		}
-		srv, err := ParseService(b)
-		if err != nil {
-			return nil, err
-		}
-		cfg.Services[i] = *srv
 	}
 	return cfg, nil
 }
 
+// settings describes the top-level settings of the Config, one setting per line
+func (c Config) settings() []string {
+	lines := []string{}
+	if len(c.Includes) > 0 {
+		lines = append(lines, fmt.Sprintf("Includes %s", strings.Join(c.Includes, ", ")))
+	}
+	if c.ShutdownGrace > 0 {
+		lines = append(lines, fmt.Sprintf("Shutdown grace %s", c.ShutdownGrace))
+	} else {
+		lines = append(lines, "Shutdown without grace")
+	}
+	if len(c.BanFile) > 0 {
+		lines = append(lines, fmt.Sprintf("Ban file %s", c.BanFile))
+	} else {
+		lines = append(lines, "Bans kept in memory")
+	}
+	return lines
+}
+
 func (c Config) String() string {
 	buf := strings.Builder{}
 	buf.WriteString("Config")
+	children := append(c.settings(), c.Log.String())
+	if c.Metrics != nil {
+		children = append(children, c.Metrics.String())
+	}
+	if c.Admin != nil {
+		children = append(children, c.Admin.String())
+	}
+	for i, child := range children {
+		if i < len(children)-1 || len(c.Services) > 0 {
+			buf.WriteString(fmt.Sprintf("\n \u251C\u2500%s", child))
+		} else {
+			buf.WriteString(fmt.Sprintf("\n \u2514\u2500%s", child))
+		}
+	}
 	for i, srv := range c.Services {
 		var indent string
 		var tree rune
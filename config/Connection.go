@@ -3,19 +3,38 @@ package config
 import (
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/zachdeibert/protomux/config/ast"
 )
 
 // Connection represents a data type which contains information needed to open a socket
 type Connection struct {
-	Host string
-	IP   net.IP
-	Port int
+	// Network is "udp" for a datagram socket, "unix" for a unix domain socket, "systemd" for a socket that was passed to the process, or empty for a TCP socket
+	Network string
+	Host    string
+	IP      net.IP
+	Port    int
+	// Path is the path of a unix domain socket, which is in the abstract namespace if it starts with '@'
+	Path string
+	// Name is the name that systemd gave a socket that was passed to the process
+	Name string
 }
 
 // ParseConnection parses an AST Connection parameter into a Connection
 func ParseConnection(conn ast.ConnectionParameterData) (*Connection, error) {
+	if len(conn.Path) > 0 {
+		return &Connection{
+			Network: "unix",
+			Path:    conn.Path,
+		}, nil
+	}
+	if len(conn.Name) > 0 {
+		return &Connection{
+			Network: "systemd",
+			Name:    conn.Name,
+		}, nil
+	}
 	return &Connection{
 		Host: conn.Host,
 		IP:   conn.IP,
@@ -23,9 +42,43 @@ func ParseConnection(conn ast.ConnectionParameterData) (*Connection, error) {
 	}, nil
 }
 
+// Dialable gets the network and address of the Connection in the form that the net package expects
+func (c Connection) Dialable() (string, string) {
+	switch c.Network {
+	case "unix":
+		return c.Network, c.Path
+	case "systemd":
+		// Inherited sockets cannot be opened again
+		return c.Network, c.Name
+	}
+	network := c.Network
+	if len(network) == 0 {
+		network = "tcp"
+	}
+	host := c.Host
+	if len(host) == 0 && c.IP != nil {
+		host = c.IP.String()
+	}
+	return network, net.JoinHostPort(host, strconv.Itoa(c.Port))
+}
+
 func (c Connection) String() string {
+	switch c.Network {
+	case "unix":
+		return fmt.Sprintf("unix:%s", c.Path)
+	case "systemd":
+		return fmt.Sprintf("systemd:%s", c.Name)
+	}
+	prefix := ""
+	if len(c.Network) > 0 {
+		prefix = c.Network + ":"
+	}
 	if len(c.Host) > 0 {
-		return fmt.Sprintf("%s:%d", c.Host, c.Port)
+		return fmt.Sprintf("%s%s:%d", prefix, c.Host, c.Port)
+	}
+	if c.IP == nil {
+		// Every address
+		return fmt.Sprintf("%s:%d", prefix, c.Port)
 	}
-	return fmt.Sprintf("%s:%d", c.IP, c.Port)
+	return prefix + net.JoinHostPort(c.IP.String(), strconv.Itoa(c.Port))
 }
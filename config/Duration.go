@@ -0,0 +1,23 @@
+package config
+
+import (
+	"time"
+
+	"github.com/zachdeibert/protomux/config/common"
+)
+
+func parseDuration(name, objType string, vals []string, location common.Location) (time.Duration, error) {
+	if len(vals) != 1 {
+		return 0, ErrorMultipleValues(name, objType, location)
+	}
+	d, err := time.ParseDuration(vals[0])
+	if err != nil {
+		return 0, ErrorInvalidDuration(name, vals[0], err, location)
+	}
+	return d, nil
+}
+
+// ParseDuration parses the single value of a parameter as a duration for protocols
+func ParseDuration(name, objType string, vals []string, location common.Location) (time.Duration, error) {
+	return parseDuration(name, objType, vals, location)
+}
@@ -24,6 +24,28 @@ const (
 	ErrorCodeDuplicateParam ErrorCode = iota
 	// ErrorCodeUnknownBlock represents when an unknonw block is given to a Config
 	ErrorCodeUnknownBlock ErrorCode = iota
+	// ErrorCodeMultipleValues represents when a parameter that should only have one value has an array
+	ErrorCodeMultipleValues ErrorCode = iota
+	// ErrorCodeInvalidDuration represents when a parameter cannot be parsed as a duration
+	ErrorCodeInvalidDuration ErrorCode = iota
+	// ErrorCodeInvalidChoice represents when a parameter is not one of the values it can be set to
+	ErrorCodeInvalidChoice ErrorCode = iota
+	// ErrorCodeOutOfRange represents when an integer parameter is outside of the values it can be set to
+	ErrorCodeOutOfRange ErrorCode = iota
+	// ErrorCodeInvalidNetwork represents when a parameter cannot be parsed as an IP address or CIDR network
+	ErrorCodeInvalidNetwork ErrorCode = iota
+	// ErrorCodeNotNetworks represents when a parameter that holds networks is given something other than strings
+	ErrorCodeNotNetworks ErrorCode = iota
+	// ErrorCodeUnsupportedAddress represents when a connection parameter is given a kind of address that the object cannot use
+	ErrorCodeUnsupportedAddress ErrorCode = iota
+	// ErrorCodeUnpairedValues represents when two parameters that are paired up in order have different numbers of values
+	ErrorCodeUnpairedValues ErrorCode = iota
+	// ErrorCodeDuplicateBlock represents when a block that can only be given once is given more than once
+	ErrorCodeDuplicateBlock ErrorCode = iota
+	// ErrorCodeConflictingParams represents when two parameters that cannot be used together are both given
+	ErrorCodeConflictingParams ErrorCode = iota
+	// ErrorCodeInvalidRule represents when an access control rule is not an allow or deny followed by a network
+	ErrorCodeInvalidRule ErrorCode = iota
 )
 
 // Error describes a parsing error
@@ -108,3 +130,111 @@ func ErrorUnknownBlock(name, objType string, location common.Location) error {
 		Locations: []common.Location{location},
 	}
 }
+
+// ErrorMultipleValues creates a new ErrorMultipleValues error
+func ErrorMultipleValues(name, objType string, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Parameter '%s' on %s object can only have one value, but has an array", name, objType),
+		Code:      ErrorCodeMultipleValues,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorInvalidDuration creates a new ErrorInvalidDuration error
+func ErrorInvalidDuration(name, value string, err error, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Unable to parse '%s' as a duration for parameter '%s': %s", value, name, err),
+		Code:      ErrorCodeInvalidDuration,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorInvalidChoice creates a new ErrorInvalidChoice error
+func ErrorInvalidChoice(name, value string, choices []string, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Invalid value '%s' for parameter '%s' (expected one of %s)", value, name, strings.Join(choices, ", ")),
+		Code:      ErrorCodeInvalidChoice,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorOutOfRange creates a new ErrorOutOfRange error
+func ErrorOutOfRange(name string, value, min, max int, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Invalid value %d for parameter '%s' (expected %d to %d)", value, name, min, max),
+		Code:      ErrorCodeOutOfRange,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorInvalidNetwork creates a new ErrorInvalidNetwork error
+func ErrorInvalidNetwork(name, value string, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Unable to parse '%s' as an IP address or CIDR network for parameter '%s'", value, name),
+		Code:      ErrorCodeInvalidNetwork,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorNotNetworks creates a new ErrorNotNetworks error
+func ErrorNotNetworks(name string, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Parameter '%s' must be given quoted IP addresses or CIDR networks", name),
+		Code:      ErrorCodeNotNetworks,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorUnsupportedAddress creates a new ErrorUnsupportedAddress error
+func ErrorUnsupportedAddress(name string, addr Connection, objType string, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Parameter '%s' cannot be %s on %s object", name, addr, objType),
+		Code:      ErrorCodeUnsupportedAddress,
+		Locations: []common.Location{location},
+	}
+}
+
+// ErrorUnpairedValues creates a new ErrorUnpairedValues error
+func ErrorUnpairedValues(name string, count int, other string, otherCount int, location, otherLocation common.Location) error {
+	return &Error{
+		Message: fmt.Sprintf("Parameter '%s' has %d values but parameter '%s' has %d", name, count, other, otherCount),
+		Code:    ErrorCodeUnpairedValues,
+		Locations: []common.Location{
+			location,
+			otherLocation,
+		},
+	}
+}
+
+// ErrorDuplicateBlock creates a new ErrorDuplicateBlock error
+func ErrorDuplicateBlock(first ast.Block, second ast.Block) error {
+	return &Error{
+		Message: fmt.Sprintf("Duplicate block '%s' specified", first.Name),
+		Code:    ErrorCodeDuplicateBlock,
+		Locations: []common.Location{
+			first.Location,
+			second.Location,
+		},
+	}
+}
+
+// ErrorConflictingParams creates a new ErrorConflictingParams error
+func ErrorConflictingParams(name, other string, location, otherLocation common.Location) error {
+	return &Error{
+		Message: fmt.Sprintf("Parameters '%s' and '%s' cannot be used together", name, other),
+		Code:    ErrorCodeConflictingParams,
+		Locations: []common.Location{
+			location,
+			otherLocation,
+		},
+	}
+}
+
+// ErrorInvalidRule creates a new ErrorInvalidRule error
+func ErrorInvalidRule(name, value string, location common.Location) error {
+	return &Error{
+		Message:   fmt.Sprintf("Unable to parse '%s' as an access control rule for parameter '%s' (expected 'allow' or 'deny' and a network)", value, name),
+		Code:      ErrorCodeInvalidRule,
+		Locations: []common.Location{location},
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import "github.com/zachdeibert/protomux/config/common"
+
+func parseInteger(name, objType string, vals []int, location common.Location) (int, error) {
+	if len(vals) != 1 {
+		return 0, ErrorMultipleValues(name, objType, location)
+	}
+	return vals[0], nil
+}
+
+func parseRange(name, objType string, vals []int, min, max int, location common.Location) (int, error) {
+	v, err := parseInteger(name, objType, vals, location)
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, ErrorOutOfRange(name, v, min, max, location)
+	}
+	return v, nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zachdeibert/protomux/config/ast"
+)
+
+// LogLevels are the values that the log level can be set to
+var LogLevels = []string{"debug", "info", "warning", "error"}
+
+// LogFormats are the values that the log format can be set to
+var LogFormats = []string{"text", "json"}
+
+// Log represents how log messages are written
+type Log struct {
+	Level      string
+	Format     string
+	File       string
+	AccessFile string
+}
+
+// DefaultLog is the logging configuration used when there is no log block
+var DefaultLog = Log{
+	Level:      "info",
+	Format:     "text",
+	File:       "",
+	AccessFile: "",
+}
+
+// ParseLog parses a Block into a Log
+func ParseLog(block ast.Block) (*Log, error) {
+	if len(block.Children.Blocks) > 0 {
+		return nil, ErrorUnknownBlock(block.Children.Blocks[0].Name, "Log", block.Children.Blocks[0].Location)
+	}
+	log := DefaultLog
+	params, err := ParseParameters(block.Children.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range params.Strings {
+		switch k {
+		case "level":
+			if log.Level, err = parseChoice(k, "Log", v, LogLevels, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "format":
+			if log.Format, err = parseChoice(k, "Log", v, LogFormats, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "file":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "Log", params.Locations[k])
+			}
+			log.File = v[0]
+			break
+		case "accessFile":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "Log", params.Locations[k])
+			}
+			log.AccessFile = v[0]
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "Log", params.Locations[k])
+		}
+	}
+	for k := range params.Connections {
+		return nil, ErrorUnknownParam(k, "Log", params.Locations[k])
+	}
+	for k := range params.Booleans {
+		return nil, ErrorUnknownParam(k, "Log", params.Locations[k])
+	}
+	for k := range params.Integers {
+		return nil, ErrorUnknownParam(k, "Log", params.Locations[k])
+	}
+	return &log, nil
+}
+
+func (l Log) String() string {
+	file := l.File
+	if file == "" {
+		file = "stdout"
+	}
+	if l.AccessFile == "" {
+		return fmt.Sprintf("Log %s %s to %s", l.Level, l.Format, file)
+	}
+	return fmt.Sprintf("Log %s %s to %s, access to %s", l.Level, l.Format, file, l.AccessFile)
+}
+
+// Access gets the configuration for the access log, which goes to the main log unless it has its own file
+func (l Log) Access() Log {
+	if l.AccessFile == "" {
+		return l
+	}
+	return Log{
+		Level:      "info",
+		Format:     l.Format,
+		File:       l.AccessFile,
+		AccessFile: "",
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zachdeibert/protomux/config/ast"
+)
+
+// Metrics represents where the metrics endpoint listens
+type Metrics struct {
+	ListenAddresses []Connection
+}
+
+// ParseMetrics parses a Block into a Metrics
+func ParseMetrics(block ast.Block) (*Metrics, error) {
+	if len(block.Children.Blocks) > 0 {
+		return nil, ErrorUnknownBlock(block.Children.Blocks[0].Name, "Metrics", block.Children.Blocks[0].Location)
+	}
+	metrics := &Metrics{}
+	params, err := ParseParameters(block.Children.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if metrics.ListenAddresses, ok = params.Connections["listen"]; !ok {
+		return nil, ErrorMissingParam("listen", "Metrics", block.Location)
+	}
+	for k := range params.Strings {
+		return nil, ErrorUnknownParam(k, "Metrics", params.Locations[k])
+	}
+	for k := range params.Connections {
+		if k != "listen" {
+			return nil, ErrorUnknownParam(k, "Metrics", params.Locations[k])
+		}
+	}
+	for k := range params.Booleans {
+		return nil, ErrorUnknownParam(k, "Metrics", params.Locations[k])
+	}
+	for k := range params.Integers {
+		return nil, ErrorUnknownParam(k, "Metrics", params.Locations[k])
+	}
+	return metrics, nil
+}
+
+func (m Metrics) String() string {
+	addrs := make([]string, len(m.ListenAddresses))
+	for i, addr := range m.ListenAddresses {
+		addrs[i] = addr.String()
+	}
+	return fmt.Sprintf("Metrics on %s", strings.Join(addrs, ", "))
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseNetwork parses an IP address or CIDR network, treating a lone address as a network of just that address
+func ParseNetwork(addr string) (*net.IPNet, error) {
+	if strings.Contains(addr, "/") {
+		_, network, err := net.ParseCIDR(addr)
+		return network, err
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.ParseError{Type: "IP address", Text: addr}
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
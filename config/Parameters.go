@@ -13,6 +13,7 @@ type Parameters struct {
 	Strings     map[string][]string
 	Connections map[string][]Connection
 	Booleans    map[string][]bool
+	Integers    map[string][]int
 	Locations   map[string]common.Location
 }
 
@@ -22,6 +23,7 @@ func ParseParameters(params []ast.Parameter) (*Parameters, error) {
 		Strings:     map[string][]string{},
 		Connections: map[string][]Connection{},
 		Booleans:    map[string][]bool{},
+		Integers:    map[string][]int{},
 		Locations:   map[string]common.Location{},
 	}
 	for _, param := range params {
@@ -55,6 +57,13 @@ func ParseParameters(params []ast.Parameter) (*Parameters, error) {
 			}
 			p.Booleans[param.Name] = vals
 			break
+		case ast.IntegerParameter:
+			vals := make([]int, len(param.Values))
+			for i, v := range param.Values {
+				vals[i] = v.(*ast.IntegerParameterData).Value
+			}
+			p.Integers[param.Name] = vals
+			break
 		default:
 			panic("Missing case")
 		}
@@ -62,6 +71,40 @@ func ParseParameters(params []ast.Parameter) (*Parameters, error) {
 	return p, nil
 }
 
+// Without copies the Parameters, leaving out the given names
+func (p Parameters) Without(names []string) Parameters {
+	params := Parameters{
+		Strings:     map[string][]string{},
+		Connections: map[string][]Connection{},
+		Booleans:    map[string][]bool{},
+		Integers:    map[string][]int{},
+		Locations:   map[string]common.Location{},
+	}
+	for k, v := range p.Strings {
+		params.Strings[k] = v
+	}
+	for k, v := range p.Connections {
+		params.Connections[k] = v
+	}
+	for k, v := range p.Booleans {
+		params.Booleans[k] = v
+	}
+	for k, v := range p.Integers {
+		params.Integers[k] = v
+	}
+	for k, v := range p.Locations {
+		params.Locations[k] = v
+	}
+	for _, k := range names {
+		delete(params.Strings, k)
+		delete(params.Connections, k)
+		delete(params.Booleans, k)
+		delete(params.Integers, k)
+		delete(params.Locations, k)
+	}
+	return params
+}
+
 func (p Parameters) String() string {
 	buf := strings.Builder{}
 	buf.WriteString("Parameters")
@@ -69,7 +112,7 @@ func (p Parameters) String() string {
 	for k, v := range p.Strings {
 		var indent string
 		var tree rune
-		if i < len(p.Strings)-1 || len(p.Connections) > 0 || len(p.Booleans) > 0 {
+		if i < len(p.Strings)-1 || len(p.Connections) > 0 || len(p.Booleans) > 0 || len(p.Integers) > 0 {
 			indent = "\n \u2502 "
 			tree = '\u251C'
 		} else {
@@ -91,7 +134,7 @@ func (p Parameters) String() string {
 	for k, v := range p.Connections {
 		var indent string
 		var tree rune
-		if i < len(p.Connections)-1 || len(p.Booleans) > 0 {
+		if i < len(p.Connections)-1 || len(p.Booleans) > 0 || len(p.Integers) > 0 {
 			indent = "\n \u2502 "
 			tree = '\u251C'
 		} else {
@@ -113,7 +156,7 @@ func (p Parameters) String() string {
 	for k, v := range p.Booleans {
 		var indent string
 		var tree rune
-		if i < len(p.Booleans)-1 {
+		if i < len(p.Booleans)-1 || len(p.Integers) > 0 {
 			indent = "\n \u2502 "
 			tree = '\u251C'
 		} else {
@@ -131,5 +174,27 @@ func (p Parameters) String() string {
 		}
 		i++
 	}
+	i = 0
+	for k, v := range p.Integers {
+		var indent string
+		var tree rune
+		if i < len(p.Integers)-1 {
+			indent = "\n \u2502 "
+			tree = '\u251C'
+		} else {
+			indent = "\n   "
+			tree = '\u2514'
+		}
+		buf.WriteString(fmt.Sprintf("\n %c\u2500%s", tree, k))
+		for j, w := range v {
+			if j < len(v)-1 {
+				tree = '\u251C'
+			} else {
+				tree = '\u2514'
+			}
+			buf.WriteString(fmt.Sprintf("%s %c\u2500%d", indent, tree, w))
+		}
+		i++
+	}
 	return buf.String()
 }
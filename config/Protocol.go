@@ -12,6 +12,8 @@ type Protocol struct {
 	Name       string
 	Parameters Parameters
 	Remotes    []Remote
+	// ACL decides which clients any of the Remotes handle
+	ACL ACL
 }
 
 // ParseProtocol parses a Block into a Protocol
@@ -25,6 +27,9 @@ func ParseProtocol(block ast.Block) (*Protocol, error) {
 		return nil, err
 	}
 	proto.Parameters = *params
+	if proto.ACL, err = parseACL(*params); err != nil {
+		return nil, err
+	}
 	for i, b := range block.Children.Blocks {
 		remote, err := ParseRemote(b)
 		if err != nil {
@@ -35,6 +40,11 @@ func ParseProtocol(block ast.Block) (*Protocol, error) {
 	return proto, nil
 }
 
+// ProtocolParameters gets the Parameters that are meant for the protocol, without the ones that the engine handles
+func (p Protocol) ProtocolParameters() Parameters {
+	return p.Parameters.Without(aclParams)
+}
+
 func (p Protocol) String() string {
 	buf := strings.Builder{}
 	buf.WriteString(fmt.Sprintf("Protocol %s", p.Name))
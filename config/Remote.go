@@ -6,10 +6,24 @@ import (
 	"github.com/zachdeibert/protomux/config/ast"
 )
 
+// remoteEngineParams are the parameters on a Remote that are handled by the engine instead of the protocol
+var remoteEngineParams = []string{"maxConnections", "maxConnectionsPerIp", "proxyProtocol"}
+
+// ProxyProtocols are the versions of the PROXY protocol that can be sent to backends
+var ProxyProtocols = []string{"v1", "v2"}
+
 // Remote represents a remote server that a Protocol handles
 type Remote struct {
 	Name       string
 	Parameters Parameters
+	// MaxConnections is the most sessions the Remote handles at once, or zero for no limit
+	MaxConnections int
+	// MaxConnectionsPerIP is the most sessions the Remote handles at once for one client IP, or zero for no limit
+	MaxConnectionsPerIP int
+	// ACL decides which clients the Remote handles
+	ACL ACL
+	// ProxyProtocol is the version of the PROXY protocol header that is sent to the backend, or empty to not send one
+	ProxyProtocol string
 }
 
 // ParseRemote parses a Block into a Remote
@@ -21,10 +35,41 @@ func ParseRemote(block ast.Block) (*Remote, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Remote{
-		Name:       block.Name,
-		Parameters: *params,
-	}, nil
+	remote := &Remote{
+		Name:                block.Name,
+		Parameters:          *params,
+		MaxConnections:      0,
+		MaxConnectionsPerIP: 0,
+		ProxyProtocol:       "",
+	}
+	if remote.ACL, err = parseACL(*params); err != nil {
+		return nil, err
+	}
+	if v, ok := params.Strings["proxyProtocol"]; ok {
+		if remote.ProxyProtocol, err = parseChoice("proxyProtocol", "Remote", v, ProxyProtocols, params.Locations["proxyProtocol"]); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range params.Integers {
+		switch k {
+		case "maxConnections":
+			if remote.MaxConnections, err = parseInteger(k, "Remote", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "maxConnectionsPerIp":
+			if remote.MaxConnectionsPerIP, err = parseInteger(k, "Remote", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return remote, nil
+}
+
+// ProtocolParameters gets the Parameters that are meant for the protocol, without the ones that the engine handles
+func (r Remote) ProtocolParameters() Parameters {
+	return r.Parameters.Without(append(append([]string{}, remoteEngineParams...), aclParams...))
 }
 
 func (r Remote) String() string {
@@ -2,43 +2,258 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/zachdeibert/protomux/config/ast"
 )
 
+// Networks are the kinds of socket that a Service can listen on
+var Networks = []string{"tcp", "udp"}
+
 // Service represents a set of addresses to listen on with how to multiplex the different protocols on those addresses
 type Service struct {
 	ListenAddresses []Connection
-	Protocols       []Protocol
+	// Network is "udp" if the Service forwards datagram flows instead of TCP connections
+	Network   string
+	Protocols []Protocol
+	// MatchTimeout is how long a connection can go unclaimed by every protocol before it is closed, or zero for no limit
+	MatchTimeout time.Duration
+	// MatchMinBytes is how much data a client has to send in each MatchInterval while it is being matched, or zero for no minimum
+	MatchMinBytes int
+	MatchInterval time.Duration
+	// MatchBufferLimit is the most data that is recorded from a client while more than one protocol could still claim it
+	MatchBufferLimit int
+	// MaxConnections is the most connections the Service accepts at once, or zero for no limit
+	MaxConnections int
+	// MaxConnectionsPerIP is the most connections the Service accepts at once from one client IP, or zero for no limit
+	MaxConnectionsPerIP int
+	// RateLimitPerIP is how many connections one client IP can open in each RateLimitInterval, or zero for no limit
+	RateLimitPerIP int
+	// RateLimitPerSubnet is how many connections one subnet can open in each RateLimitInterval, or zero for no limit
+	RateLimitPerSubnet int
+	RateLimitInterval  time.Duration
+	// SubnetPrefix and SubnetPrefix6 are the sizes of the IPv4 and IPv6 subnets that are rate limited together
+	SubnetPrefix  int
+	SubnetPrefix6 int
+	// BanAfter is how many failed matches within BanWindow get a client IP banned for BanTime, or zero to never ban
+	BanAfter  int
+	BanWindow time.Duration
+	// BanTime is how long a client IP that failed too often stays banned, or zero to ban it forever
+	BanTime time.Duration
+	// ACL decides which clients the Service accepts connections from
+	ACL ACL
+	// AcceptProxyProtocol is whether every connection starts with a PROXY protocol header giving the real client address
+	AcceptProxyProtocol bool
+	// TrustedProxies are the networks that are allowed to send PROXY protocol headers, which must be given when AcceptProxyProtocol is set
+	TrustedProxies []*net.IPNet
+	// FlowTimeout is how long a datagram flow can be idle before it is forgotten
+	FlowTimeout time.Duration
+	// IPv6Only stops IPv6 sockets from also accepting IPv4 clients, so an address without a host gets separate IPv4 and IPv6 sockets
+	IPv6Only bool
+	// TLS is the certificates to terminate TLS with before matching protocols, or nil if clients send the protocols in plaintext
+	TLS *TLS
 }
 
 // ParseService parses a Block into a Service
 func ParseService(block ast.Block) (*Service, error) {
 	srv := &Service{
-		Protocols: make([]Protocol, len(block.Children.Blocks)),
+		Protocols:           []Protocol{},
+		MatchTimeout:        30 * time.Second,
+		MatchMinBytes:       0,
+		MatchInterval:       5 * time.Second,
+		MatchBufferLimit:    64 * 1024,
+		MaxConnections:      0,
+		MaxConnectionsPerIP: 0,
+		RateLimitPerIP:      0,
+		RateLimitPerSubnet:  0,
+		RateLimitInterval:   time.Minute,
+		SubnetPrefix:        24,
+		SubnetPrefix6:       64,
+		BanAfter:            0,
+		BanWindow:           10 * time.Minute,
+		BanTime:             time.Hour,
+		AcceptProxyProtocol: false,
+		TrustedProxies:      []*net.IPNet{},
+		Network:             "tcp",
+		FlowTimeout:         time.Minute,
+		IPv6Only:            false,
+		TLS:                 nil,
 	}
 	params, err := ParseParameters(block.Children.Parameters)
 	if err != nil {
 		return nil, err
 	}
+	if srv.ACL, err = parseACL(*params); err != nil {
+		return nil, err
+	}
 	var ok bool
 	if srv.ListenAddresses, ok = params.Connections["listen"]; !ok {
 		return nil, ErrorMissingParam("listen", "Service", block.Location)
 	}
-	for k := range params.Strings {
-		return nil, ErrorUnknownParam(k, "Service", params.Locations[k])
+	for k, v := range params.Strings {
+		switch k {
+		case "matchTimeout":
+			if srv.MatchTimeout, err = parseDuration(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "matchInterval":
+			if srv.MatchInterval, err = parseDuration(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "rateLimitInterval":
+			if srv.RateLimitInterval, err = parseDuration(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "banWindow":
+			if srv.BanWindow, err = parseDuration(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "flowTimeout":
+			if srv.FlowTimeout, err = parseDuration(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "network":
+			if srv.Network, err = parseChoice(k, "Service", v, Networks, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "banTime":
+			if srv.BanTime, err = parseDuration(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "acl", "allow", "deny":
+			break
+		case "trustedProxies":
+			for _, addr := range v {
+				network, err := ParseNetwork(addr)
+				if err != nil {
+					return nil, ErrorInvalidNetwork(k, addr, params.Locations[k])
+				}
+				srv.TrustedProxies = append(srv.TrustedProxies, network)
+			}
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "Service", params.Locations[k])
+		}
 	}
 	for k := range params.Connections {
 		if k != "listen" {
 			return nil, ErrorUnknownParam(k, "Service", params.Locations[k])
 		}
 	}
-	for k := range params.Booleans {
-		return nil, ErrorUnknownParam(k, "Service", params.Locations[k])
+	for k, v := range params.Booleans {
+		switch k {
+		case "acceptProxyProtocol":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "Service", params.Locations[k])
+			}
+			srv.AcceptProxyProtocol = v[0]
+			break
+		case "ipv6Only":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "Service", params.Locations[k])
+			}
+			srv.IPv6Only = v[0]
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "Service", params.Locations[k])
+		}
+	}
+	for k, v := range params.Integers {
+		switch k {
+		case "matchMinBytes":
+			if srv.MatchMinBytes, err = parseRange(k, "Service", v, 0, 1<<30, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "matchBufferLimit":
+			if srv.MatchBufferLimit, err = parseRange(k, "Service", v, 1, 1<<30, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "maxConnections":
+			if srv.MaxConnections, err = parseInteger(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "maxConnectionsPerIp":
+			if srv.MaxConnectionsPerIP, err = parseInteger(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "rateLimitPerIp":
+			if srv.RateLimitPerIP, err = parseInteger(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "rateLimitPerSubnet":
+			if srv.RateLimitPerSubnet, err = parseInteger(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "subnetPrefix":
+			if srv.SubnetPrefix, err = parseRange(k, "Service", v, 0, 32, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "subnetPrefix6":
+			if srv.SubnetPrefix6, err = parseRange(k, "Service", v, 0, 128, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		case "banAfter":
+			if srv.BanAfter, err = parseInteger(k, "Service", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "Service", params.Locations[k])
+		}
+	}
+	// Trusting every network would let any client forge the address that ACLs, bans and limits are checked against
+	if srv.AcceptProxyProtocol && len(srv.TrustedProxies) == 0 {
+		return nil, ErrorMissingParam("trustedProxies", "Service", params.Locations["acceptProxyProtocol"])
+	}
+	if srv.Network == "udp" {
+		if srv.AcceptProxyProtocol {
+			return nil, ErrorUnknownParam("acceptProxyProtocol", "udp Service", params.Locations["acceptProxyProtocol"])
+		}
+		for _, b := range block.Children.Blocks {
+			if b.Name == "tls" {
+				return nil, ErrorUnknownBlock(b.Name, "udp Service", b.Location)
+			}
+		}
+		for i, addr := range srv.ListenAddresses {
+			if addr.Network == "unix" {
+				return nil, ErrorUnsupportedAddress("listen", addr, "udp Service", params.Locations["listen"])
+			}
+			// Inherited sockets already know whether they are for datagrams
+			if addr.Network != "systemd" {
+				srv.ListenAddresses[i].Network = srv.Network
+			}
+		}
 	}
 	protos := map[string]ast.Block{}
+	var tlsBlock *ast.Block
 	for i, b := range block.Children.Blocks {
+		if b.Name == "tls" {
+			if tlsBlock != nil {
+				return nil, ErrorDuplicateBlock(*tlsBlock, b)
+			}
+			tlsBlock = &block.Children.Blocks[i]
+			if srv.TLS, err = ParseTLS(b); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		proto, err := ParseProtocol(b)
 		if err != nil {
 			return nil, err
@@ -47,25 +262,90 @@ func ParseService(block ast.Block) (*Service, error) {
 			return nil, ErrorDuplicateProtocol(first, b)
 		}
 		protos[proto.Name] = b
-		srv.Protocols[i] = *proto
+		srv.Protocols = append(srv.Protocols, *proto)
 	}
 	return srv, nil
 }
 
+// limitString formats a limit where zero means there is no limit
+func limitString(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", limit)
+}
+
+// settings describes how the Service handles clients, one setting per line
+func (s Service) settings() []string {
+	network := fmt.Sprintf("Network %s", s.Network)
+	if s.Network == "udp" {
+		network += fmt.Sprintf(", flows idle after %s", s.FlowTimeout)
+	}
+	if s.IPv6Only {
+		network += ", IPv6 only"
+	}
+	match := "Matching without a timeout"
+	if s.MatchTimeout > 0 {
+		match = fmt.Sprintf("Matching within %s", s.MatchTimeout)
+	}
+	match += fmt.Sprintf(", buffering up to %d bytes", s.MatchBufferLimit)
+	if s.MatchMinBytes > 0 {
+		match += fmt.Sprintf(", at least %d bytes every %s", s.MatchMinBytes, s.MatchInterval)
+	}
+	lines := []string{
+		network,
+		match,
+		fmt.Sprintf("Connections %s, %s per IP", limitString(s.MaxConnections), limitString(s.MaxConnectionsPerIP)),
+		fmt.Sprintf("Rate %s per IP, %s per /%d or /%d subnet every %s", limitString(s.RateLimitPerIP), limitString(s.RateLimitPerSubnet), s.SubnetPrefix, s.SubnetPrefix6, s.RateLimitInterval),
+	}
+	if s.BanAfter > 0 && s.BanTime == 0 {
+		lines = append(lines, fmt.Sprintf("Ban forever after %d failed matches within %s", s.BanAfter, s.BanWindow))
+	} else if s.BanAfter > 0 {
+		lines = append(lines, fmt.Sprintf("Ban for %s after %d failed matches within %s", s.BanTime, s.BanAfter, s.BanWindow))
+	} else {
+		lines = append(lines, "Never ban")
+	}
+	if len(s.ACL.Rules) > 0 {
+		lines = append(lines, fmt.Sprintf("ACL %s", s.ACL))
+	} else {
+		lines = append(lines, "ACL allows all")
+	}
+	if s.AcceptProxyProtocol {
+		proxies := make([]string, len(s.TrustedProxies))
+		for i, network := range s.TrustedProxies {
+			proxies[i] = network.String()
+		}
+		lines = append(lines, fmt.Sprintf("PROXY protocol from %s", strings.Join(proxies, ", ")))
+	} else {
+		lines = append(lines, "No PROXY protocol")
+	}
+	if s.TLS != nil {
+		lines = append(lines, s.TLS.String())
+	} else {
+		lines = append(lines, "No TLS")
+	}
+	return lines
+}
+
 func (s Service) String() string {
 	buf := strings.Builder{}
 	buf.WriteString("Service")
-	for i, addr := range s.ListenAddresses {
+	children := []string{}
+	for _, addr := range s.ListenAddresses {
+		children = append(children, addr.String())
+	}
+	children = append(children, s.settings()...)
+	for i, child := range children {
 		var indent string
 		var tree rune
-		if i < len(s.ListenAddresses)-1 || len(s.Protocols) > 0 {
+		if i < len(children)-1 || len(s.Protocols) > 0 {
 			indent = "\n \u2502 "
 			tree = '\u251C'
 		} else {
 			indent = "\n   "
 			tree = '\u2514'
 		}
-		buf.WriteString(fmt.Sprintf("\n %c\u2500%s", tree, strings.ReplaceAll(addr.String(), "\n", indent)))
+		buf.WriteString(fmt.Sprintf("\n %c\u2500%s", tree, strings.ReplaceAll(child, "\n", indent)))
 	}
 	for i, proto := range s.Protocols {
 		var indent string
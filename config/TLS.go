@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zachdeibert/protomux/config/ast"
+)
+
+// TLS represents the certificates that a Service terminates TLS with before matching protocols
+type TLS struct {
+	// Certificates and Keys are the files holding each certificate chain and its private key, which are paired up in order
+	Certificates []string
+	Keys         []string
+	// Optional lets clients that do not start with a TLS handshake be matched in plaintext on the same port
+	Optional bool
+	// DetectTimeout is how long a client on a port with optional TLS has to start sending before it is treated as plaintext
+	DetectTimeout time.Duration
+}
+
+// ParseTLS parses a Block into a TLS
+func ParseTLS(block ast.Block) (*TLS, error) {
+	if len(block.Children.Blocks) > 0 {
+		return nil, ErrorUnknownBlock(block.Children.Blocks[0].Name, "TLS", block.Children.Blocks[0].Location)
+	}
+	t := &TLS{
+		Optional:      false,
+		DetectTimeout: 5 * time.Second,
+	}
+	params, err := ParseParameters(block.Children.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if t.Certificates, ok = params.Strings["cert"]; !ok {
+		return nil, ErrorMissingParam("cert", "TLS", block.Location)
+	}
+	if t.Keys, ok = params.Strings["key"]; !ok {
+		return nil, ErrorMissingParam("key", "TLS", block.Location)
+	}
+	if len(t.Certificates) != len(t.Keys) {
+		return nil, ErrorUnpairedValues("cert", len(t.Certificates), "key", len(t.Keys), params.Locations["cert"], params.Locations["key"])
+	}
+	for k, v := range params.Strings {
+		switch k {
+		case "cert", "key":
+			break
+		case "detectTimeout":
+			if t.DetectTimeout, err = parseDuration(k, "TLS", v, params.Locations[k]); err != nil {
+				return nil, err
+			}
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "TLS", params.Locations[k])
+		}
+	}
+	for k := range params.Connections {
+		return nil, ErrorUnknownParam(k, "TLS", params.Locations[k])
+	}
+	for k, v := range params.Booleans {
+		switch k {
+		case "optional":
+			if len(v) != 1 {
+				return nil, ErrorMultipleValues(k, "TLS", params.Locations[k])
+			}
+			t.Optional = v[0]
+			break
+		default:
+			return nil, ErrorUnknownParam(k, "TLS", params.Locations[k])
+		}
+	}
+	for k := range params.Integers {
+		return nil, ErrorUnknownParam(k, "TLS", params.Locations[k])
+	}
+	return t, nil
+}
+
+func (t TLS) String() string {
+	if t.Optional {
+		return fmt.Sprintf("Optional TLS with %s, detected within %s", strings.Join(t.Certificates, ", "), t.DetectTimeout)
+	}
+	return fmt.Sprintf("TLS with %s", strings.Join(t.Certificates, ", "))
+}
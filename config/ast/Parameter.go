@@ -26,6 +26,16 @@ func parseStringParameter(lexeme lexer.Lexeme) (interface{}, error) {
 }
 
 func parseConnectionParameter(lexeme lexer.Lexeme) (interface{}, error) {
+	if lexeme.Type == lexer.SocketLexeme {
+		return &ConnectionParameterData{
+			Path: lexeme.StringValue,
+		}, nil
+	}
+	if lexeme.Type == lexer.SocketNameLexeme {
+		return &ConnectionParameterData{
+			Name: lexeme.StringValue,
+		}, nil
+	}
 	if lexeme.Type != lexer.ConnectionLexeme {
 		return nil, ErrorParameterArrayType(lexeme, "connection")
 	}
@@ -53,6 +63,15 @@ func parseBooleanParameter(lexeme lexer.Lexeme) (interface{}, error) {
 	}, nil
 }
 
+func parseIntegerParameter(lexeme lexer.Lexeme) (interface{}, error) {
+	if lexeme.Type != lexer.IntegerLexeme {
+		return nil, ErrorParameterArrayType(lexeme, "integer")
+	}
+	return &IntegerParameterData{
+		Value: lexeme.IntValue,
+	}, nil
+}
+
 // ParseParameter parses a Parameter
 func ParseParameter(stream *lexer.LexemeReader, first lexer.Lexeme, second lexer.Lexeme) (*Parameter, *lexer.Lexeme, error) {
 	param := &Parameter{
@@ -105,7 +124,7 @@ func ParseParameter(stream *lexer.LexemeReader, first lexer.Lexeme, second lexer
 						param.Type = StringParameter
 						parser = parseStringParameter
 						break
-					case lexer.ConnectionLexeme:
+					case lexer.ConnectionLexeme, lexer.SocketLexeme, lexer.SocketNameLexeme:
 						param.Type = ConnectionParameter
 						parser = parseConnectionParameter
 						break
@@ -113,6 +132,10 @@ func ParseParameter(stream *lexer.LexemeReader, first lexer.Lexeme, second lexer
 						param.Type = BooleanParameter
 						parser = parseBooleanParameter
 						break
+					case lexer.IntegerLexeme:
+						param.Type = IntegerParameter
+						parser = parseIntegerParameter
+						break
 					case lexer.BlockStartLexeme, lexer.BlockEndLexeme, lexer.ArrayStartLexeme:
 						break
 					default:
@@ -128,7 +151,7 @@ func ParseParameter(stream *lexer.LexemeReader, first lexer.Lexeme, second lexer
 				break
 			}
 		}
-	case lexer.ConnectionLexeme:
+	case lexer.ConnectionLexeme, lexer.SocketLexeme, lexer.SocketNameLexeme:
 		val, err := parseConnectionParameter(second)
 		if err != nil {
 			return nil, nil, err
@@ -144,9 +167,33 @@ func ParseParameter(stream *lexer.LexemeReader, first lexer.Lexeme, second lexer
 		param.Type = StringParameter
 		param.Values = []interface{}{val}
 		break
+	case lexer.IntegerLexeme:
+		val, err := parseIntegerParameter(second)
+		if err != nil {
+			return nil, nil, err
+		}
+		param.Type = IntegerParameter
+		param.Values = []interface{}{val}
+		break
+	case lexer.KeywordLexeme:
+		// Bare words are strings unless they spell a boolean
+		if second.StringValue == "true" || second.StringValue == "false" {
+			val, err := parseBooleanParameter(second)
+			if err != nil {
+				return nil, nil, err
+			}
+			param.Type = BooleanParameter
+			param.Values = []interface{}{val}
+		} else {
+			param.Type = StringParameter
+			param.Values = []interface{}{&StringParameterData{
+				Value: second.StringValue,
+			}}
+		}
+		break
 	case lexer.LineFeedLexeme:
 		return nil, nil, ErrorSingleLexemeLine(first)
-	case lexer.KeywordLexeme, lexer.BlockStartLexeme, lexer.BlockEndLexeme, lexer.ArrayEndLexeme, lexer.ArraySeparatorLexeme:
+	case lexer.BlockStartLexeme, lexer.BlockEndLexeme, lexer.ArrayEndLexeme, lexer.ArraySeparatorLexeme:
 		return nil, nil, ErrorUnexpectedParameterLexeme(second)
 	default:
 		panic("Missing case")
@@ -3,6 +3,7 @@ package ast
 import (
 	"fmt"
 	"net"
+	"strconv"
 )
 
 // ParameterType represents the type of a parameter
@@ -11,10 +12,12 @@ type ParameterType int
 const (
 	// StringParameter represents a parameter that is an arbitrary string
 	StringParameter ParameterType = iota
-	// ConnectionParameter represents a parameter that consists of an IP or hostname and port number
+	// ConnectionParameter represents a parameter that consists of an IP or hostname and port number, the path of a unix domain socket, or the name of a socket from systemd
 	ConnectionParameter ParameterType = iota
 	// BooleanParameter represents a parameter that is either true or false
 	BooleanParameter ParameterType = iota
+	// IntegerParameter represents a parameter that is a whole number
+	IntegerParameter ParameterType = iota
 )
 
 // StringParameterData is the data contained in a StringParameter
@@ -31,13 +34,26 @@ type ConnectionParameterData struct {
 	Host string
 	IP   net.IP
 	Port int
+	// Path is the path of a unix domain socket, or empty for an IP socket
+	Path string
+	// Name is the name of a socket that was passed to the process by systemd
+	Name string
 }
 
 func (p ConnectionParameterData) String() string {
+	if len(p.Path) > 0 {
+		return fmt.Sprintf("unix:%s", p.Path)
+	}
+	if len(p.Name) > 0 {
+		return fmt.Sprintf("systemd:%s", p.Name)
+	}
 	if len(p.Host) > 0 {
 		return fmt.Sprintf("%s:%d", p.Host, p.Port)
 	}
-	return fmt.Sprintf("%s:%d", p.IP, p.Port)
+	if p.IP == nil {
+		return fmt.Sprintf(":%d", p.Port)
+	}
+	return net.JoinHostPort(p.IP.String(), strconv.Itoa(p.Port))
 }
 
 // BooleanParameterData is the data contained in a BooleanParameter
@@ -48,3 +64,12 @@ type BooleanParameterData struct {
 func (b BooleanParameterData) String() string {
 	return fmt.Sprint(b.Value)
 }
+
+// IntegerParameterData is the data contained in an IntegerParameter
+type IntegerParameterData struct {
+	Value int
+}
+
+func (i IntegerParameterData) String() string {
+	return fmt.Sprint(i.Value)
+}
@@ -15,6 +15,10 @@ const (
 	ErrorCodeIntParse ErrorCode = iota
 	// ErrorCodeInvalidToken represents when a token is received that should not be where it is
 	ErrorCodeInvalidToken ErrorCode = iota
+	// ErrorCodeUnknownSocketType represents when a socket address starts with a type other than unix or systemd
+	ErrorCodeUnknownSocketType ErrorCode = iota
+	// ErrorCodeInvalidIP represents when the address between brackets is not an IPv6 address
+	ErrorCodeInvalidIP ErrorCode = iota
 )
 
 // Error describes a lexing error
@@ -45,3 +49,21 @@ func ErrorInvalidToken(token tokenizer.Token) error {
 		Location: token.Location,
 	}
 }
+
+// ErrorUnknownSocketType creates a new ErrorUnknownSocketType error
+func ErrorUnknownSocketType(token tokenizer.Token) error {
+	return &Error{
+		Message:  fmt.Sprintf("Unknown socket type '%s'", token.Value),
+		Code:     ErrorCodeUnknownSocketType,
+		Location: token.Location,
+	}
+}
+
+// ErrorInvalidIP creates a new ErrorInvalidIP error
+func ErrorInvalidIP(location common.Location, val string) error {
+	return &Error{
+		Message:  fmt.Sprintf("'%s' is not an IPv6 address", val),
+		Code:     ErrorCodeInvalidIP,
+		Location: location,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/zachdeibert/protomux/config/common"
 	"github.com/zachdeibert/protomux/config/tokenizer"
 )
 
@@ -21,6 +22,7 @@ var lexemeTrieKeyTokenDot = &LexemeTrieNode{
 		nil, // DotSymbol
 		nil, // CommaSymbol
 		nil, // LineFeedToken
+		nil, // PathToken
 	},
 }
 
@@ -39,7 +41,9 @@ var lexemeTrieKeyToken = &LexemeTrieNode{
 		nil, // CloseBracketSymbol
 		{ // ColonSymbol
 			Children: []*LexemeTrieNode{
-				nil, // KeyToken
+				{ // KeyToken
+					Handler: socketLexeme,
+				},
 				{ // IntToken
 					Handler: func(t []tokenizer.Token) (*Lexeme, error) {
 						port, err := strconv.ParseUint(t[len(t)-1].Value, 10, 16)
@@ -58,7 +62,9 @@ var lexemeTrieKeyToken = &LexemeTrieNode{
 						}, nil
 					},
 				},
-				nil, // StringToken
+				{ // StringToken
+					Handler: socketLexeme,
+				},
 				nil, // OpenBraceSymbol
 				nil, // CloseBraceSymbol
 				nil, // OpenBracketSymbol
@@ -67,14 +73,122 @@ var lexemeTrieKeyToken = &LexemeTrieNode{
 				nil, // DotSymbol
 				nil, // CommaSymbol
 				nil, // LineFeedToken
+				{ // PathToken
+					Handler: socketLexeme,
+				},
 			},
 		},
 		lexemeTrieKeyTokenDot, // DotSymbol
 		nil,                   // CommaSymbol
 		nil,                   // LineFeedToken
+		nil,                   // PathToken
 	},
 }
 
+// socketLexeme creates the Lexeme for a unix:path socket address or a systemd:name inherited socket, where the path or name may be quoted
+func socketLexeme(t []tokenizer.Token) (*Lexeme, error) {
+	if len(t) == 3 && t[0].Value == "unix" {
+		return &Lexeme{
+			Type:        SocketLexeme,
+			StringValue: t[2].Value,
+		}, nil
+	}
+	if len(t) == 3 && t[0].Value == "systemd" && t[2].Type != tokenizer.PathToken {
+		return &Lexeme{
+			Type:        SocketNameLexeme,
+			StringValue: t[2].Value,
+		}, nil
+	}
+	return nil, ErrorUnknownSocketType(t[0])
+}
+
+// lexemeTrieIPv6 matches the address inside the brackets of an [IPv6]:port address, which the tokenizer splits into keys, integers, colons and dots
+var lexemeTrieIPv6 = &LexemeTrieNode{
+	Children: []*LexemeTrieNode{
+		nil, // KeyToken (lexemeTrieIPv6)
+		nil, // IntToken (lexemeTrieIPv6)
+		nil, // StringToken
+		nil, // OpenBraceSymbol
+		nil, // CloseBraceSymbol
+		nil, // OpenBracketSymbol
+		{ // CloseBracketSymbol
+			Children: []*LexemeTrieNode{
+				nil, // KeyToken
+				nil, // IntToken
+				nil, // StringToken
+				nil, // OpenBraceSymbol
+				nil, // CloseBraceSymbol
+				nil, // OpenBracketSymbol
+				nil, // CloseBracketSymbol
+				{ // ColonSymbol
+					Children: []*LexemeTrieNode{
+						nil, // KeyToken
+						{ // IntToken
+							Handler: ipv6Lexeme,
+						},
+						nil, // StringToken
+						nil, // OpenBraceSymbol
+						nil, // CloseBraceSymbol
+						nil, // OpenBracketSymbol
+						nil, // CloseBracketSymbol
+						nil, // ColonSymbol
+						nil, // DotSymbol
+						nil, // CommaSymbol
+						nil, // LineFeedToken
+						nil, // PathToken
+					},
+				},
+				nil, // DotSymbol
+				nil, // CommaSymbol
+				nil, // LineFeedToken
+				nil, // PathToken
+			},
+		},
+		nil, // ColonSymbol (lexemeTrieIPv6)
+		nil, // DotSymbol (lexemeTrieIPv6)
+		nil, // CommaSymbol
+		nil, // LineFeedToken
+		nil, // PathToken
+	},
+}
+
+func init() {
+	lexemeTrieIPv6.Children[tokenizer.KeyToken] = lexemeTrieIPv6
+	lexemeTrieIPv6.Children[tokenizer.IntToken] = lexemeTrieIPv6
+	lexemeTrieIPv6.Children[tokenizer.ColonSymbol] = lexemeTrieIPv6
+	lexemeTrieIPv6.Children[tokenizer.DotSymbol] = lexemeTrieIPv6
+}
+
+// ipv6Lexeme creates the Lexeme for an [IPv6]:port address
+func ipv6Lexeme(t []tokenizer.Token) (*Lexeme, error) {
+	inner := t[1 : len(t)-3]
+	buf := strings.Builder{}
+	for i, tok := range inner {
+		// The tokenizer drops whitespace, so it has to be ruled out here
+		if i > 0 && tok.Location.CharStart != inner[i-1].Location.CharStart+inner[i-1].Location.CharLen {
+			return nil, ErrorInvalidToken(tok)
+		}
+		buf.WriteString(tok.Value)
+	}
+	locations := make([]common.Location, len(t)-2)
+	for i, tok := range t[:len(t)-2] {
+		locations[i] = tok.Location
+	}
+	ip := net.ParseIP(buf.String())
+	if ip == nil || ip.To4() != nil && !strings.Contains(buf.String(), ":") {
+		return nil, ErrorInvalidIP(common.Merge(locations), buf.String())
+	}
+	port, err := strconv.ParseUint(t[len(t)-1].Value, 10, 16)
+	if err != nil {
+		return nil, ErrorIntParse(t[len(t)-1].Location, t[len(t)-1].Value, err)
+	}
+	return &Lexeme{
+		Type:     ConnectionLexeme,
+		IntValue: int(port),
+		IPValue:  ip,
+	}, nil
+}
+
 // LexemeTrie is a trie that is used for converting tokens into lexemes
 var LexemeTrie = LexemeTrieNode{
 	Children: []*LexemeTrieNode{
@@ -88,6 +202,16 @@ var LexemeTrie = LexemeTrieNode{
 			},
 		},
 		{ // IntToken
+			Handler: func(t []tokenizer.Token) (*Lexeme, error) {
+				val, err := strconv.ParseInt(t[0].Value, 10, 32)
+				if err != nil {
+					return nil, ErrorIntParse(t[0].Location, t[0].Value, err)
+				}
+				return &Lexeme{
+					Type:     IntegerLexeme,
+					IntValue: int(val),
+				}, nil
+			},
 			Children: []*LexemeTrieNode{
 				nil, // KeyToken
 				nil, // IntToken
@@ -176,11 +300,13 @@ var LexemeTrie = LexemeTrieNode{
 																		nil, // DotSymbol
 																		nil, // CommaSymbol
 																		nil, // LineFeedToken
+																		nil, // PathToken
 																	},
 																},
 																nil, // DotSymbol
 																nil, // CommaSymbol
 																nil, // LineFeedToken
+																nil, // PathToken
 															},
 														},
 														nil, // StringToken
@@ -192,10 +318,12 @@ var LexemeTrie = LexemeTrieNode{
 														nil, // DotSymbol
 														nil, // CommaSymbol
 														nil, // LineFeedToken
+														nil, // PathToken
 													},
 												},
 												nil, // CommaSymbol
 												nil, // LineFeedToken
+												nil, // PathToken
 											},
 										},
 										nil, // StringToken
@@ -207,10 +335,12 @@ var LexemeTrie = LexemeTrieNode{
 										nil, // DotSymbol
 										nil, // CommaSymbol
 										nil, // LineFeedToken
+										nil, // PathToken
 									},
 								},
 								nil, // CommaSymbol
 								nil, // LineFeedToken
+								nil, // PathToken
 							},
 						},
 						nil, // StringToken
@@ -222,10 +352,12 @@ var LexemeTrie = LexemeTrieNode{
 						nil, // DotSymbol
 						nil, // CommaSymbol
 						nil, // LineFeedToken
+						nil, // PathToken
 					},
 				},
 				nil, // CommaSymbol
 				nil, // LineFeedToken
+				nil, // PathToken
 			},
 		},
 		{ // StringToken
@@ -251,6 +383,7 @@ var LexemeTrie = LexemeTrieNode{
 			},
 		},
 		{ // OpenBracketSymbol
+			Children: lexemeTrieIPv6.Children,
 			Handler: func(t []tokenizer.Token) (*Lexeme, error) {
 				return &Lexeme{
 					Type: ArrayStartLexeme,
@@ -274,10 +407,10 @@ var LexemeTrie = LexemeTrieNode{
 							// TODO wrap the error
 							return nil, err
 						}
+						// Without a host the address is every address
 						return &Lexeme{
-							Type:        ConnectionLexeme,
-							StringValue: "0.0.0.0",
-							IntValue:    int(port),
+							Type:     ConnectionLexeme,
+							IntValue: int(port),
 						}, nil
 					},
 				},
@@ -290,6 +423,7 @@ var LexemeTrie = LexemeTrieNode{
 				nil, // DotSymbol
 				nil, // CommaSymbol
 				nil, // LineFeedToken
+				nil, // PathToken
 			},
 		},
 		nil, // DotSymbol
@@ -307,5 +441,6 @@ var LexemeTrie = LexemeTrieNode{
 				}, nil
 			},
 		},
+		nil, // PathToken
 	},
 }
@@ -0,0 +1,111 @@
+package lexer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/zachdeibert/protomux/config/tokenizer"
+)
+
+// lex reads every Lexeme from the input, leaving out the line feeds
+func lex(input string) ([]Lexeme, error) {
+	reader := CreateLexemeReader(tokenizer.CreateTokenReader(strings.NewReader(input), "test.conf"))
+	lexemes := []Lexeme{}
+	for {
+		lexeme, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if lexeme == nil {
+			return lexemes, nil
+		}
+		if lexeme.Type != LineFeedLexeme {
+			lexemes = append(lexemes, *lexeme)
+		}
+	}
+}
+
+// describe formats the parts of a Lexeme that the tests compare
+func describe(lexemes []Lexeme) string {
+	strs := make([]string, len(lexemes))
+	for i, l := range lexemes {
+		switch l.Type {
+		case ConnectionLexeme:
+			if l.IPValue != nil {
+				strs[i] = net.JoinHostPort(l.IPValue.String(), fmt.Sprint(l.IntValue))
+			} else {
+				strs[i] = fmt.Sprintf("%s:%d", l.StringValue, l.IntValue)
+			}
+			break
+		case ArrayStartLexeme:
+			strs[i] = "["
+			break
+		case ArrayEndLexeme:
+			strs[i] = "]"
+			break
+		case ArraySeparatorLexeme:
+			strs[i] = ","
+			break
+		case IntegerLexeme:
+			strs[i] = fmt.Sprint(l.IntValue)
+			break
+		default:
+			strs[i] = l.StringValue
+			break
+		}
+	}
+	return strings.Join(strs, " ")
+}
+
+func TestLexIPv6(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"[::1]:25565", "[::1]:25565"},
+		{"[::]:25565", "[::]:25565"},
+		{"[2001:db8::1]:443", "[2001:db8::1]:443"},
+		{"[2001:0db8:0000:0000:0000:ff00:0042:8329]:80", "[2001:db8::ff00:42:8329]:80"},
+		{"[fe80::a:b]:8080", "[fe80::a:b]:8080"},
+		{"[::ffff:192.0.2.1]:80", "192.0.2.1:80"},
+		{"[[::1]:25565, [2001:db8::1]:25566]", "[ [::1]:25565 , [2001:db8::1]:25566 ]"},
+		{"[127.0.0.1:25565, [::1]:25565]", "[ 127.0.0.1:25565 , [::1]:25565 ]"},
+		{"[1, 2]", "[ 1 , 2 ]"},
+		{"[play.example.com:25565]", "[ play.example.com:25565 ]"},
+		{"[]", "[ ]"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lexemes, err := lex(test.input)
+			if err != nil {
+				t.Fatalf("lex(%q) error = %v", test.input, err)
+			}
+			if got := describe(lexemes); got != test.want {
+				t.Errorf("lex(%q) = %s, want %s", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLexIPv6Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  ErrorCode
+	}{
+		{"[1.2.3.4]:80", ErrorCodeInvalidIP},
+		{"[::g]:80", ErrorCodeInvalidIP},
+		{"[1:2:3:4:5:6:7:8:9]:80", ErrorCodeInvalidIP},
+		{"[:: 1]:80", ErrorCodeInvalidToken},
+		{"[::1]:65536", ErrorCodeIntParse},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := lex(test.input)
+			if e, ok := err.(*Error); !ok || e.Code != test.code {
+				t.Fatalf("lex(%q) error = %v, want code %d", test.input, err, test.code)
+			}
+		})
+	}
+}
@@ -22,4 +22,10 @@ const (
 	StringLexeme LexemeType = iota
 	// LineFeedLexeme represents the end of a line
 	LineFeedLexeme LexemeType = iota
+	// IntegerLexeme is a literal integer
+	IntegerLexeme LexemeType = iota
+	// SocketLexeme contains the path of a unix domain socket
+	SocketLexeme LexemeType = iota
+	// SocketNameLexeme contains the name of a listening socket that was passed to the process by systemd
+	SocketNameLexeme LexemeType = iota
 )
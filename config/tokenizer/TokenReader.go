@@ -84,7 +84,7 @@ func (t *TokenReader) Next() (*Token, error) {
 			case StringToken:
 				t.StringBuf = []byte{}
 				fallthrough
-			case KeyToken, IntToken:
+			case KeyToken, IntToken, PathToken:
 				t.CharStart = t.CharNo
 				t.CharLen = 1
 				break
@@ -109,7 +109,8 @@ func (t *TokenReader) Next() (*Token, error) {
 		} else {
 			switch t.Type {
 			case KeyToken, IntToken:
-				if TokenLookup[c] == t.Type {
+				// Keys can contain digits after their first character, like v2 or mc1.example.com
+				if TokenLookup[c] == t.Type || (t.Type == KeyToken && TokenLookup[c] == IntToken) {
 					t.CharLen++
 				} else {
 					start := t.CharStart
@@ -129,6 +130,30 @@ func (t *TokenReader) Next() (*Token, error) {
 					}, nil
 				}
 				break
+			case PathToken:
+				// Paths can contain anything except the characters that end a value
+				switch TokenLookup[c] {
+				case WhitespaceToken, CommentToken, CommaSymbol, CloseBracketSymbol, CloseBraceSymbol:
+					start := t.CharStart
+					t.CharStart = -1
+					t.CharNo--
+					t.WasNewline = false
+					return &Token{
+						Type:  PathToken,
+						Value: string(t.Line[start : t.CharNo+1]),
+						Location: common.Location{
+							FileName:  t.FileName,
+							Line:      t.Line,
+							LineNo:    t.LineNo,
+							CharStart: start,
+							CharLen:   t.CharNo - start + 1,
+						},
+					}, nil
+				default:
+					t.CharLen++
+					break
+				}
+				break
 			case StringToken:
 				t.CharLen++
 				if t.Escape {
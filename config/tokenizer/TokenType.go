@@ -26,6 +26,8 @@ const (
 	CommaSymbol TokenType = iota
 	// LineFeedToken represents the end of a line
 	LineFeedToken TokenType = iota
+	// PathToken represents an unquoted file system path, which starts with '/' or with '@' for the abstract namespace
+	PathToken TokenType = iota
 )
 
 const (
@@ -50,13 +52,13 @@ var TokenLookup = [256]TokenType{
 	// ' ' ! " # $ % & '
 	WhitespaceToken, InvalidToken, StringToken, CommentToken, InvalidToken, InvalidToken, InvalidToken, StringToken,
 	// ( ) * + , - . /
-	InvalidToken, InvalidToken, InvalidToken, InvalidToken, CommaSymbol, InvalidToken, DotSymbol, InvalidToken,
+	InvalidToken, InvalidToken, InvalidToken, InvalidToken, CommaSymbol, InvalidToken, DotSymbol, PathToken,
 	// 0 1 2 3 4 5 6 7
 	IntToken, IntToken, IntToken, IntToken, IntToken, IntToken, IntToken, IntToken,
 	// 8 9 : ; < = > ?
 	IntToken, IntToken, ColonSymbol, InvalidToken, InvalidToken, InvalidToken, InvalidToken, InvalidToken,
 	// @ A B C D E F G
-	InvalidToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken,
+	PathToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken,
 	// H I J K L M N O
 	KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken, KeyToken,
 	// P Q R S T U V W
@@ -1,9 +1,28 @@
 package framework
 
-import "net"
+import (
+	"net"
+
+	"github.com/zachdeibert/protomux/logging"
+)
 
 // Connection represents a socket stream that is given to a protocol
 type Connection interface {
 	net.Conn
+	// RequireExclusive waits until this connection is the only candidate left
 	RequireExclusive(priority int) error
+	// AcquireSlot counts the connection against the connection limits of its remote once it has become exclusive, returning ErrorRemoteFull if the remote is at a limit
+	//
+	// Protocols only call it for sessions that tie up the remote, so that short requests like status pings are still answered when it is full.
+	AcquireSlot() error
+	// SetGoodbye sets the function that tells the client why it is being disconnected, or nil if the client cannot be told
+	SetGoodbye(goodbye func(reason string) error)
+	// SetFarewell sets the function that tells the client why its session is cut off when it outlasts the shutdown grace period, or nil if the client cannot be told
+	SetFarewell(farewell func(reason string) error)
+	// Logger gets the Logger for messages about this connection
+	Logger() *logging.Logger
+	// Annotate adds a field to the access log record and to later log messages about this connection
+	Annotate(key string, value interface{})
+	// ProxyProtocol gets the version of the PROXY protocol header ("v1" or "v2") that backends expect, or an empty string if they do not expect one
+	ProxyProtocol() string
 }
@@ -0,0 +1,17 @@
+package framework
+
+// CountedError is implemented by errors that are counted in the metrics of the package they come from
+//
+// Errors are counted when they are reported rather than when they are created, so the ones that are only part of matching a connection are not counted.
+type CountedError interface {
+	error
+	Count()
+}
+
+// CountError counts an error in the metrics of the package it came from as it is reported, returning it so that it can be logged
+func CountError(err error) error {
+	if c, ok := err.(CountedError); ok {
+		c.Count()
+	}
+	return err
+}
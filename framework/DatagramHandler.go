@@ -0,0 +1,14 @@
+package framework
+
+import "net"
+
+// DatagramHandler is implemented by a ProtocolInstance that can handle datagram flows
+//
+// MatchDatagram is called with the first datagram from each client while the engine holds its locks, so it must return quickly.
+// Once a flow matches, the engine forwards every datagram in both directions between the client and the backend until the flow is idle.
+type DatagramHandler interface {
+	// MatchDatagram determines if the flow that starts with a datagram is for this instance
+	MatchDatagram(datagram []byte) bool
+	// DatagramBackend gets the address of the backend that matched flows are forwarded to, which has to be resolved ahead of time since it is called while the engine receives datagrams
+	DatagramBackend() *net.UDPAddr
+}
@@ -0,0 +1,61 @@
+package framework
+
+import (
+	"fmt"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// ErrorCode describes a specific error
+type ErrorCode int
+
+const (
+	// ErrorCodeDial represents when a connection to a remote server could not be opened
+	ErrorCodeDial ErrorCode = iota
+	// ErrorCodeReplay represents when the consumed data could not be replayed to a remote server
+	ErrorCodeReplay ErrorCode = iota
+	// ErrorCodeRemoteFull represents when a protocol matched a connection but its remote is already handling as many as it is allowed to
+	ErrorCodeRemoteFull ErrorCode = iota
+	// ErrorCodeProxyHeader represents when a connection did not start with a valid PROXY protocol header
+	ErrorCodeProxyHeader ErrorCode = iota
+)
+
+// Error describes a framework error
+type Error struct {
+	Message string
+	Code    ErrorCode
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// ErrorDial creates a new ErrorDial error
+func ErrorDial(addr config.Connection, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to connect to %s: %s", addr, err),
+		Code:    ErrorCodeDial,
+	}
+}
+
+// ErrorReplay creates a new ErrorReplay error
+func ErrorReplay(addr config.Connection, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to replay data to %s: %s", addr, err),
+		Code:    ErrorCodeReplay,
+	}
+}
+
+// ErrorRemoteFull error
+var ErrorRemoteFull error = &Error{
+	Message: "Remote is handling too many connections",
+	Code:    ErrorCodeRemoteFull,
+}
+
+// ErrorProxyHeader creates a new ErrorProxyHeader error
+func ErrorProxyHeader(reason string) error {
+	return &Error{
+		Message: fmt.Sprintf("Invalid PROXY protocol header: %s", reason),
+		Code:    ErrorCodeProxyHeader,
+	}
+}
@@ -0,0 +1,14 @@
+package framework
+
+import "time"
+
+// IdleMatcher is implemented by a Matcher that can judge a prefix that may be complete once the client stops sending
+//
+// Some clients send a short request and then wait for a reply, so their prefix would never grow enough for Match to decide.
+type IdleMatcher interface {
+	Matcher
+	// IdleTimeout gets how long the client has to stop sending before MatchIdle is used
+	IdleTimeout() time.Duration
+	// MatchIdle judges the prefix after the client has not sent anything for IdleTimeout
+	MatchIdle(prefix []byte) ProtocolState
+}
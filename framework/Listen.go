@@ -0,0 +1,28 @@
+package framework
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// Listen opens a stream listener on a Connection, replacing a unix domain socket that was left behind by an instance that did not exit cleanly
+func Listen(addr config.Connection) (net.Listener, error) {
+	network, address := addr.Dialable()
+	// Sockets in the abstract namespace disappear with the process that owns them
+	if network == "unix" && !strings.HasPrefix(address, "@") {
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial(network, address); err == nil {
+				conn.Close()
+				return nil, syscall.EADDRINUSE
+			}
+			if err := os.Remove(address); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return net.Listen(network, address)
+}
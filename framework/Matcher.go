@@ -0,0 +1,10 @@
+package framework
+
+// Matcher is implemented by a ProtocolInstance that can classify a connection by looking at the data received so far
+//
+// Match is called while the engine holds its locks, so it must return quickly and must not use the Connection.
+// Match is first called with an empty prefix before the client has sent anything.
+// Handle is only called once Match returns ProtocolMatched, and it is given the whole prefix again.
+type Matcher interface {
+	Match(prefix []byte) ProtocolState
+}
@@ -0,0 +1,89 @@
+package framework
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Dial opens a connection to a remote server
+func Dial(remote config.Connection) (net.Conn, error) {
+	network, address := remote.Dialable()
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, ErrorDial(remote, err)
+	}
+	return conn, nil
+}
+
+// DialTimeout opens a connection to a remote server, giving up if it takes longer than the timeout
+func DialTimeout(remote config.Connection, timeout time.Duration) (net.Conn, error) {
+	network, address := remote.Dialable()
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, ErrorDial(remote, err)
+	}
+	return conn, nil
+}
+
+// Proxy connects to a remote server, replays the data that was already consumed from the Connection, then forwards data in both directions until the session ends
+func Proxy(conn Connection, remote config.Connection, replay []byte) error {
+	backend, err := Connect(conn, remote, replay)
+	if err != nil {
+		return err
+	}
+	return Splice(conn, backend)
+}
+
+// Connect opens the connection to a remote server for a Connection and replays the data that was already consumed from the Connection
+func Connect(conn Connection, remote config.Connection, replay []byte) (net.Conn, error) {
+	backend, err := Dial(remote)
+	if err != nil {
+		return nil, err
+	}
+	if version := conn.ProxyProtocol(); version != "" {
+		replay = append(ProxyHeader(version, conn.RemoteAddr(), conn.LocalAddr()), replay...)
+	}
+	if _, err = backend.Write(replay); err != nil {
+		backend.Close()
+		return nil, ErrorReplay(remote, err)
+	}
+	return backend, nil
+}
+
+func pump(dst net.Conn, src net.Conn) error {
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	if cw, ok := dst.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return dst.Close()
+}
+
+// Splice forwards data between a Connection and a remote server until both directions have been closed
+func Splice(conn Connection, backend net.Conn) error {
+	defer backend.Close()
+	errs := make(chan error, 2)
+	go func() {
+		errs <- pump(backend, conn)
+	}()
+	go func() {
+		errs <- pump(conn, backend)
+	}()
+	var res error
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil && res == nil {
+			res = err
+			conn.Close()
+			backend.Close()
+		}
+	}
+	return res
+}
@@ -0,0 +1,162 @@
+package framework
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxProxyV1Length is the longest that a version 1 PROXY protocol header can be
+const maxProxyV1Length = 107
+
+// proxyV2Signature starts every version 2 PROXY protocol header
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyAddresses gets the TCP addresses of a connection, or nil if it did not come from TCP
+func proxyAddresses(source, destination net.Addr) (*net.TCPAddr, *net.TCPAddr) {
+	src, ok := source.(*net.TCPAddr)
+	if !ok {
+		return nil, nil
+	}
+	dst, ok := destination.(*net.TCPAddr)
+	if !ok {
+		return nil, nil
+	}
+	return src, dst
+}
+
+// proxyV6String formats an address for a TCP6 version 1 header, which needs IPv4 addresses to be written as IPv4-mapped IPv6 addresses
+func proxyV6String(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return "::ffff:" + v4.String()
+	}
+	return ip.String()
+}
+
+// ProxyHeader creates a HAProxy PROXY protocol header of the given version ("v1" or "v2") that tells a backend where a connection came from, or that it came from protomux itself if source and destination are nil
+func ProxyHeader(version string, source, destination net.Addr) []byte {
+	src, dst := proxyAddresses(source, destination)
+	v4 := src != nil && src.IP.To4() != nil && dst.IP.To4() != nil
+	if version == "v1" {
+		if src == nil {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		if v4 {
+			return []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", src.IP.To4(), dst.IP.To4(), src.Port, dst.Port))
+		}
+		return []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", proxyV6String(src.IP), proxyV6String(dst.IP), src.Port, dst.Port))
+	}
+	buf := bytes.Buffer{}
+	buf.Write(proxyV2Signature)
+	if src == nil {
+		// LOCAL command with no address block
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+	var addrs []byte
+	if v4 {
+		buf.Write([]byte{0x21, 0x11})
+		addrs = append(append(addrs, src.IP.To4()...), dst.IP.To4()...)
+	} else {
+		buf.Write([]byte{0x21, 0x21})
+		addrs = append(append(addrs, src.IP.To16()...), dst.IP.To16()...)
+	}
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports, uint16(src.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dst.Port))
+	addrs = append(addrs, ports...)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(addrs)))
+	buf.Write(length)
+	buf.Write(addrs)
+	return buf.Bytes()
+}
+
+// ReadProxyHeader reads a version 1 or 2 PROXY protocol header, returning the addresses it gives or nil addresses if it does not give any
+func ReadProxyHeader(r io.Reader) (net.Addr, net.Addr, error) {
+	start := make([]byte, 8)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(start[:6], []byte("PROXY ")) {
+		return readProxyV1(r, start)
+	}
+	if bytes.Equal(start, proxyV2Signature[:8]) {
+		return readProxyV2(r)
+	}
+	return nil, nil, ErrorProxyHeader("missing signature")
+}
+
+func readProxyV1(r io.Reader, start []byte) (net.Addr, net.Addr, error) {
+	line := append([]byte{}, start...)
+	b := []byte{0}
+	// The header has to be read a byte at a time so that none of the data after it is consumed
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxProxyV1Length {
+			return nil, nil, ErrorProxyHeader("line too long")
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b[0])
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrorProxyHeader("malformed version 1 header")
+	}
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, srcErr := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, dstErr := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || srcErr != nil || dstErr != nil {
+		return nil, nil, ErrorProxyHeader("malformed version 1 address")
+	}
+	return &net.TCPAddr{IP: src, Port: int(srcPort)}, &net.TCPAddr{IP: dst, Port: int(dstPort)}, nil
+}
+
+func readProxyV2(r io.Reader) (net.Addr, net.Addr, error) {
+	rest := make([]byte, 8)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(rest[:4], proxyV2Signature[8:]) {
+		return nil, nil, ErrorProxyHeader("missing signature")
+	}
+	if rest[4]>>4 != 2 {
+		return nil, nil, ErrorProxyHeader("unsupported version")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(rest[6:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+	if rest[4]&0x0F == 0 {
+		// LOCAL connections come from the proxy itself
+		return nil, nil, nil
+	}
+	var ipLen int
+	switch rest[5] >> 4 {
+	case 1:
+		ipLen = 4
+		break
+	case 2:
+		ipLen = 16
+		break
+	default:
+		// Other address families do not describe a network client
+		return nil, nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, nil, ErrorProxyHeader("address block too short")
+	}
+	src := net.IP(append([]byte{}, body[:ipLen]...))
+	dst := net.IP(append([]byte{}, body[ipLen:2*ipLen]...))
+	srcPort := binary.BigEndian.Uint16(body[2*ipLen:])
+	dstPort := binary.BigEndian.Uint16(body[2*ipLen+2:])
+	return &net.TCPAddr{IP: src, Port: int(srcPort)}, &net.TCPAddr{IP: dst, Port: int(dstPort)}, nil
+}
@@ -0,0 +1,106 @@
+package framework
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// tcpAddr creates a TCP address, panicking if the IP is invalid
+func tcpAddr(ip string, port int) *net.TCPAddr {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		panic("invalid IP " + ip)
+	}
+	return &net.TCPAddr{
+		IP:   parsed,
+		Port: port,
+	}
+}
+
+func TestProxyHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  net.Addr
+		dst  net.Addr
+	}{
+		{"ipv4", tcpAddr("192.0.2.10", 51234), tcpAddr("198.51.100.1", 25565)},
+		{"ipv6", tcpAddr("2001:db8::10", 51234), tcpAddr("2001:db8::1", 25565)},
+		{"ipv4 source", tcpAddr("192.0.2.10", 51234), tcpAddr("2001:db8::1", 25565)},
+		{"ipv4 destination", tcpAddr("2001:db8::10", 51234), tcpAddr("198.51.100.1", 25565)},
+		{"local", nil, nil},
+		{"not tcp", &net.UnixAddr{Name: "/run/client.sock", Net: "unix"}, &net.UnixAddr{Name: "/run/protomux.sock", Net: "unix"}},
+	}
+	for _, version := range []string{"v1", "v2"} {
+		for _, test := range tests {
+			t.Run(version+" "+test.name, func(t *testing.T) {
+				header := ProxyHeader(version, test.src, test.dst)
+				r := bytes.NewReader(append(append([]byte{}, header...), "payload"...))
+				src, dst, err := ReadProxyHeader(r)
+				if err != nil {
+					t.Fatalf("ReadProxyHeader(%q) error = %v", header, err)
+				}
+				want, _ := proxyAddresses(test.src, test.dst)
+				if want == nil {
+					if src != nil || dst != nil {
+						t.Errorf("ReadProxyHeader(%q) = %v, %v, want no addresses", header, src, dst)
+					}
+				} else if src.String() != test.src.String() || dst.String() != test.dst.String() {
+					t.Errorf("ReadProxyHeader(%q) = %v, %v, want %v, %v", header, src, dst, test.src, test.dst)
+				}
+				if rest, _ := ioutil.ReadAll(r); string(rest) != "payload" {
+					t.Errorf("ReadProxyHeader(%q) left %q, want the payload", header, rest)
+				}
+			})
+		}
+	}
+}
+
+func TestProxyHeaderV1Mapped(t *testing.T) {
+	header := ProxyHeader("v1", tcpAddr("192.0.2.10", 51234), tcpAddr("2001:db8::1", 25565))
+	if want := "PROXY TCP6 ::ffff:192.0.2.10 2001:db8::1 51234 25565\r\n"; string(header) != want {
+		t.Errorf("ProxyHeader() = %q, want %q", header, want)
+	}
+}
+
+func TestReadProxyHeaderMalformed(t *testing.T) {
+	v2 := func(rest ...byte) string {
+		return string(append(append([]byte{}, proxyV2Signature...), rest...))
+	}
+	tests := []struct {
+		name   string
+		header string
+		eof    bool
+	}{
+		{"no signature", "GET / HTTP/1.1\r\n", false},
+		{"empty", "", true},
+		{"v1 unknown protocol", "PROXY UDP4 192.0.2.10 198.51.100.1 51234 25565\r\n", false},
+		{"v1 missing port", "PROXY TCP4 192.0.2.10 198.51.100.1 51234\r\n", false},
+		{"v1 extra field", "PROXY TCP4 192.0.2.10 198.51.100.1 51234 25565 1\r\n", false},
+		{"v1 bad address", "PROXY TCP4 192.0.2.300 198.51.100.1 51234 25565\r\n", false},
+		{"v1 bad port", "PROXY TCP4 192.0.2.10 198.51.100.1 51234 65536\r\n", false},
+		{"v1 too long", "PROXY TCP6 " + string(bytes.Repeat([]byte("a"), maxProxyV1Length)) + "\r\n", false},
+		{"v1 unterminated", "PROXY TCP4 192.0.2.10 198.51.100.1 51234 25565", true},
+		{"v2 bad signature", v2()[:8] + "\x00\x00\x00\x00\x21\x11\x00\x0C", false},
+		{"v2 bad version", v2(0x11, 0x11, 0x00, 0x00), false},
+		{"v2 short addresses", v2(0x21, 0x11, 0x00, 0x04, 192, 0, 2, 10), false},
+		{"v2 short ipv6 addresses", v2(0x21, 0x21, 0x00, 0x0C, 192, 0, 2, 10, 198, 51, 100, 1, 0xC8, 0x22, 0x63, 0xDD), false},
+		{"v2 truncated", v2(0x21, 0x11, 0x00, 0x0C, 192, 0, 2, 10), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := ReadProxyHeader(bytes.NewReader([]byte(test.header)))
+			if test.eof {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					t.Fatalf("ReadProxyHeader(%q) error = %v, want EOF", test.header, err)
+				}
+				return
+			}
+			if e, ok := err.(*Error); !ok || e.Code != ErrorCodeProxyHeader {
+				t.Fatalf("ReadProxyHeader(%q) error = %v, want code %d", test.header, err, ErrorCodeProxyHeader)
+			}
+		})
+	}
+}
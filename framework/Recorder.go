@@ -0,0 +1,23 @@
+package framework
+
+import "io"
+
+// Recorder is a stream that keeps a copy of all data that has been read through it
+type Recorder struct {
+	Base io.Reader
+	Data []byte
+}
+
+// CreateRecorder creates a new Recorder
+func CreateRecorder(base io.Reader) *Recorder {
+	return &Recorder{
+		Base: base,
+		Data: []byte{},
+	}
+}
+
+func (r *Recorder) Read(b []byte) (int, error) {
+	n, err := r.Base.Read(b)
+	r.Data = append(r.Data, b[:n]...)
+	return n, err
+}
@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/zachdeibert/protomux/admin"
+	"github.com/zachdeibert/protomux/config"
+)
+
+// Command runs a command that was sent to the admin socket
+func (e *Engine) Command(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return admin.ErrorUsage("command [arguments...]")
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return admin.ErrorUsage("list")
+		}
+		e.list(out)
+		return nil
+	case "kill":
+		if len(args) != 2 {
+			return admin.ErrorUsage("kill [id]")
+		}
+		rc := e.findRemote(args[1])
+		if rc == nil {
+			if f := e.findFlow(args[1]); f != nil {
+				f.CloseFor("killed by admin")
+				fmt.Fprintf(out, "Closed flow %d from %s\n", f.ID, f.Client)
+				return nil
+			}
+			return admin.ErrorUnknownConnection(args[1])
+		}
+		rc.CloseFor("killed by admin")
+		fmt.Fprintf(out, "Closed connection %d from %s\n", rc.ID, rc.Socket.RemoteAddr())
+		return nil
+	case "pause", "resume":
+		if len(args) != 2 {
+			return admin.ErrorUsage(fmt.Sprintf("%s [address]", args[0]))
+		}
+		l := e.findListener(args[1])
+		if l == nil {
+			return admin.ErrorUnknownListener(args[1])
+		}
+		if args[0] == "pause" {
+			l.Pause()
+			l.Log.Infof("Listener paused")
+			fmt.Fprintf(out, "Paused listener %s\n", l.Address)
+		} else {
+			l.Resume()
+			l.Log.Infof("Listener resumed")
+			fmt.Fprintf(out, "Resumed listener %s\n", l.Address)
+		}
+		return nil
+	case "config":
+		if len(args) != 1 {
+			return admin.ErrorUsage("config")
+		}
+		e.Mutex.Lock()
+		cfg := e.Config
+		e.Mutex.Unlock()
+		fmt.Fprintln(out, cfg)
+		return nil
+	case "bans":
+		if len(args) != 1 {
+			return admin.ErrorUsage("bans")
+		}
+		now := time.Now()
+		for _, ban := range e.Bans.List() {
+			if ban.Expires.IsZero() {
+				fmt.Fprintf(out, "%s forever: %s\n", ban.Network, ban.Reason)
+			} else {
+				fmt.Fprintf(out, "%s for %s: %s\n", ban.Network, ban.Expires.Sub(now).Round(time.Second), ban.Reason)
+			}
+		}
+		return nil
+	case "ban":
+		if len(args) != 2 && len(args) != 3 {
+			return admin.ErrorUsage("ban [network] [duration]")
+		}
+		network, err := config.ParseNetwork(args[1])
+		if err != nil {
+			return admin.ErrorInvalidArgument("network", args[1], err)
+		}
+		var duration time.Duration
+		if len(args) == 3 {
+			if duration, err = time.ParseDuration(args[2]); err != nil {
+				return admin.ErrorInvalidArgument("duration", args[2], err)
+			}
+		}
+		ban, err := e.Bans.Add(network, duration, "banned by admin")
+		if err != nil {
+			return err
+		}
+		e.Log.Infof("Banned %s by admin", ban.Network)
+		if ban.Expires.IsZero() {
+			fmt.Fprintf(out, "Banned %s forever\n", ban.Network)
+		} else {
+			fmt.Fprintf(out, "Banned %s for %s\n", ban.Network, duration)
+		}
+		return nil
+	case "unban":
+		if len(args) != 2 {
+			return admin.ErrorUsage("unban [network]")
+		}
+		network, err := config.ParseNetwork(args[1])
+		if err != nil {
+			return admin.ErrorInvalidArgument("network", args[1], err)
+		}
+		removed, err := e.Bans.Remove(network)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return admin.ErrorNotBanned(network.String())
+		}
+		e.Log.Infof("Unbanned %s by admin", network)
+		fmt.Fprintf(out, "Unbanned %s\n", network)
+		return nil
+	default:
+		return admin.ErrorUnknownCommand(args[0])
+	}
+}
+
+// snapshot copies the Services and their Listeners so that they can be inspected without holding the Engine lock
+func (e *Engine) snapshot() ([]*Service, [][]*Listener) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	services := append([]*Service{}, e.Services...)
+	listeners := make([][]*Listener, len(services))
+	for i, s := range services {
+		listeners[i] = s.ListenerList()
+	}
+	return services, listeners
+}
+
+// list writes every Service with its Listeners, RemoteConnections and their candidate Connections
+func (e *Engine) list(out io.Writer) {
+	services, listeners := e.snapshot()
+	for i, s := range services {
+		fmt.Fprintf(out, "service %s\n", s.Name())
+		for _, l := range listeners[i] {
+			state := "accepting"
+			if l.IsPaused() {
+				state = "paused"
+			}
+			fmt.Fprintf(out, "  listener %s (%s)\n", l.Address, state)
+			for _, f := range l.FlowList() {
+				f.list(out)
+			}
+		}
+		s.Mutex.Lock()
+		remotes := append([]*RemoteConnection{}, s.Remotes...)
+		s.Mutex.Unlock()
+		for _, rc := range remotes {
+			rc.list(out)
+		}
+	}
+}
+
+// list writes the state of the RemoteConnection and its candidate Connections
+func (rc *RemoteConnection) list(out io.Writer) {
+	rc.Mutex.Lock()
+	defer rc.Mutex.Unlock()
+	fmt.Fprintf(out, "  connection %d from %s on %s, open %s, %d bytes in, %d bytes out\n",
+		rc.ID, rc.Socket.RemoteAddr(), listenerAddr(rc.Socket), time.Since(rc.Accepted).Round(time.Millisecond),
+		atomic.LoadInt64(&rc.BytesRead), atomic.LoadInt64(&rc.BytesWrote))
+	for _, c := range rc.Connections {
+		var state string
+		if rc.Exclusive == c {
+			state = "exclusive"
+		} else if c.Matcher != nil {
+			state = "waiting for data"
+		} else if c.Priority >= 0 {
+			state = fmt.Sprintf("requires exclusive at priority %d", c.Priority)
+		} else {
+			state = "matching"
+		}
+		fmt.Fprintf(out, "    %s (%s)\n", c.Protocol, state)
+	}
+}
+
+// list writes the state of the Flow
+func (f *Flow) list(out io.Writer) {
+	fmt.Fprintf(out, "    flow %d from %s to %s, open %s, idle %s, %d bytes in, %d bytes out\n",
+		f.ID, f.Client, f.Protocol, time.Since(f.Accepted).Round(time.Millisecond),
+		time.Since(time.Unix(0, atomic.LoadInt64(&f.Active))).Round(time.Millisecond),
+		atomic.LoadInt64(&f.BytesRead), atomic.LoadInt64(&f.BytesWrote))
+}
+
+// findRemote finds an open RemoteConnection by its ID
+func (e *Engine) findRemote(id string) *RemoteConnection {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	services, _ := e.snapshot()
+	for _, s := range services {
+		s.Mutex.Lock()
+		for _, rc := range s.Remotes {
+			if rc.ID == n {
+				s.Mutex.Unlock()
+				return rc
+			}
+		}
+		s.Mutex.Unlock()
+	}
+	return nil
+}
+
+// findFlow finds an open Flow by its ID
+func (e *Engine) findFlow(id string) *Flow {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	_, listeners := e.snapshot()
+	for _, ls := range listeners {
+		for _, l := range ls {
+			for _, f := range l.FlowList() {
+				if f.ID == n {
+					return f
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findListener finds a Listener by the address it was configured with
+func (e *Engine) findListener(addr string) *Listener {
+	_, listeners := e.snapshot()
+	for _, ls := range listeners {
+		for _, l := range ls {
+			if l.Address.String() == addr {
+				return l
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// Ban keeps a network from connecting until it expires
+type Ban struct {
+	Network *net.IPNet
+	// Expires is when the Ban ends, or the zero time if it never does
+	Expires time.Time
+	Reason  string
+}
+
+// BanList holds the bans for the whole Engine along with the failed matches that lead up to them
+type BanList struct {
+	File     string
+	Bans     []Ban
+	Failures map[string][]time.Time
+	Swept    time.Time
+	Mutex    sync.Mutex
+}
+
+// CreateBanList creates a new BanList, loading the bans that were saved in the file
+func CreateBanList(file string) (*BanList, error) {
+	b := &BanList{
+		File:     file,
+		Bans:     []Ban{},
+		Failures: map[string][]time.Time{},
+		Swept:    time.Now(),
+	}
+	if file != "" {
+		if err := b.load(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b Ban) String() string {
+	if b.Expires.IsZero() {
+		return fmt.Sprintf("%s never %s", b.Network, b.Reason)
+	}
+	return fmt.Sprintf("%s %s %s", b.Network, b.Expires.UTC().Format(time.RFC3339), b.Reason)
+}
+
+// load reads the bans from the file, skipping the ones that have already expired
+func (b *BanList) load() error {
+	f, err := os.Open(b.File)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return ErrorBanFile(b.File, err)
+	}
+	defer f.Close()
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 3)
+		if len(fields) < 2 {
+			return ErrorBanFileSyntax(b.File, line)
+		}
+		network, err := config.ParseNetwork(fields[0])
+		if err != nil {
+			return ErrorBanFileSyntax(b.File, line)
+		}
+		ban := Ban{
+			Network: network,
+			Reason:  "",
+		}
+		if fields[1] != "never" {
+			if ban.Expires, err = time.Parse(time.RFC3339, fields[1]); err != nil {
+				return ErrorBanFileSyntax(b.File, line)
+			}
+			if !ban.Expires.After(now) {
+				continue
+			}
+		}
+		if len(fields) > 2 {
+			ban.Reason = fields[2]
+		}
+		b.Bans = append(b.Bans, ban)
+	}
+	if err := scanner.Err(); err != nil {
+		return ErrorBanFile(b.File, err)
+	}
+	return nil
+}
+
+// save writes the bans to the file, replacing it all at once so that a crash cannot leave half of a list behind
+func (b *BanList) save() error {
+	if b.File == "" {
+		return nil
+	}
+	buf := strings.Builder{}
+	buf.WriteString("# network expires reason\n")
+	for _, ban := range b.Bans {
+		buf.WriteString(ban.String())
+		buf.WriteString("\n")
+	}
+	tmp := filepath.Join(filepath.Dir(b.File), "."+filepath.Base(b.File)+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(buf.String()), 0600); err != nil {
+		return ErrorBanFile(b.File, err)
+	}
+	if err := os.Rename(tmp, b.File); err != nil {
+		os.Remove(tmp)
+		return ErrorBanFile(b.File, err)
+	}
+	return nil
+}
+
+// prune removes the bans that have expired
+func (b *BanList) prune(now time.Time) {
+	n := 0
+	for _, ban := range b.Bans {
+		if ban.Expires.IsZero() || ban.Expires.After(now) {
+			b.Bans[n] = ban
+			n++
+		}
+	}
+	b.Bans = b.Bans[:n]
+}
+
+// SetFile moves the BanList to a different file, saving the current bans there
+func (b *BanList) SetFile(file string) error {
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+	if file == b.File {
+		return nil
+	}
+	b.File = file
+	return b.save()
+}
+
+// Banned finds the Ban that covers an IP, or nil if it is allowed to connect
+func (b *BanList) Banned(ip string) *Ban {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	now := time.Now()
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+	for _, ban := range b.Bans {
+		if (ban.Expires.IsZero() || ban.Expires.After(now)) && ban.Network.Contains(addr) {
+			return &ban
+		}
+	}
+	return nil
+}
+
+// List gets the bans that have not expired yet
+func (b *BanList) List() []Ban {
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+	b.prune(time.Now())
+	return append([]Ban{}, b.Bans...)
+}
+
+// Add bans a network for a duration, or forever if the duration is zero, replacing any existing ban on the same network
+func (b *BanList) Add(network *net.IPNet, duration time.Duration, reason string) (Ban, error) {
+	ban := Ban{
+		Network: network,
+		Reason:  reason,
+	}
+	if duration > 0 {
+		ban.Expires = time.Now().Add(duration)
+	}
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+	b.prune(time.Now())
+	b.remove(network)
+	b.Bans = append(b.Bans, ban)
+	return ban, b.save()
+}
+
+// Remove lifts the ban on a network, returning whether there was one
+func (b *BanList) Remove(network *net.IPNet) (bool, error) {
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+	if !b.remove(network) {
+		return false, nil
+	}
+	return true, b.save()
+}
+
+func (b *BanList) remove(network *net.IPNet) bool {
+	n := 0
+	for _, ban := range b.Bans {
+		if ban.Network.String() != network.String() {
+			b.Bans[n] = ban
+			n++
+		}
+	}
+	removed := n < len(b.Bans)
+	b.Bans = b.Bans[:n]
+	return removed
+}
+
+// Fail records a failed match from an IP, banning it for banTime once it has failed too many times within the window
+//
+// Like with Add, a banTime of zero bans the IP forever.
+func (b *BanList) Fail(ip string, after int, window time.Duration, banTime time.Duration) (*Ban, error) {
+	if after <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	b.Mutex.Lock()
+	if now.Sub(b.Swept) > window {
+		// IPs that failed once and went away should not be remembered forever
+		for k, times := range b.Failures {
+			if now.Sub(times[len(times)-1]) > window {
+				delete(b.Failures, k)
+			}
+		}
+		b.Swept = now
+	}
+	times := []time.Time{}
+	for _, t := range b.Failures[ip] {
+		if now.Sub(t) <= window {
+			times = append(times, t)
+		}
+	}
+	times = append(times, now)
+	if len(times) < after {
+		b.Failures[ip] = times
+		b.Mutex.Unlock()
+		return nil, nil
+	}
+	delete(b.Failures, ip)
+	b.Mutex.Unlock()
+	network, err := config.ParseNetwork(ip)
+	if err != nil {
+		return nil, nil
+	}
+	ban, err := b.Add(network, banTime, fmt.Sprintf("%d failed matches within %s", len(times), window))
+	return &ban, err
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// banFile creates a temporary directory holding a ban file with the given contents, which is left out if contents is empty
+func banFile(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "protomux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "bans")
+	if contents != "" {
+		if err := ioutil.WriteFile(file, []byte(contents), 0600); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return file, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// banStrings formats a list of bans to compare them
+func banStrings(bans []Ban) []string {
+	strs := make([]string, len(bans))
+	for i, ban := range bans {
+		strs[i] = ban.String()
+	}
+	return strs
+}
+
+func TestBanListLoad(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	file, cleanup := banFile(t, "# network expires reason\n"+
+		"\n"+
+		"192.0.2.0/24 never abuse from the whole range\n"+
+		"  198.51.100.7 "+future+" 3 failed matches within 10m0s  \n"+
+		"203.0.113.1 "+past+" expired\n"+
+		"2001:db8::/32 never\n")
+	defer cleanup()
+	b, err := CreateBanList(file)
+	if err != nil {
+		t.Fatalf("CreateBanList() error = %v", err)
+	}
+	want := []string{
+		"192.0.2.0/24 never abuse from the whole range",
+		"198.51.100.7/32 " + future + " 3 failed matches within 10m0s",
+		"2001:db8::/32 never ",
+	}
+	got := banStrings(b.List())
+	if len(got) != len(want) {
+		t.Fatalf("List() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("List()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	for ip, banned := range map[string]bool{"192.0.2.200": true, "198.51.100.7": true, "198.51.100.8": false, "203.0.113.1": false, "2001:db8::1": true} {
+		if got := b.Banned(ip) != nil; got != banned {
+			t.Errorf("Banned(%s) = %t, want %t", ip, got, banned)
+		}
+	}
+}
+
+func TestBanListLoadMissing(t *testing.T) {
+	file, cleanup := banFile(t, "")
+	defer cleanup()
+	b, err := CreateBanList(file)
+	if err != nil {
+		t.Fatalf("CreateBanList() error = %v", err)
+	}
+	if len(b.List()) != 0 {
+		t.Errorf("List() = %v, want no bans", b.List())
+	}
+}
+
+func TestBanListLoadSyntax(t *testing.T) {
+	tests := []string{
+		"192.0.2.0/24\n",
+		"example.com never\n",
+		"192.0.2.0/33 never\n",
+		"192.0.2.0/24 tomorrow\n",
+		"# fine\n192.0.2.0/24 never\n192.0.2.1\n",
+	}
+	for _, contents := range tests {
+		file, cleanup := banFile(t, contents)
+		_, err := CreateBanList(file)
+		cleanup()
+		if e, ok := err.(*Error); !ok || e.Code != ErrorCodeBanFileSyntax {
+			t.Errorf("CreateBanList(%q) error = %v, want code %d", contents, err, ErrorCodeBanFileSyntax)
+		}
+	}
+}
+
+func TestBanListSave(t *testing.T) {
+	file, cleanup := banFile(t, "")
+	defer cleanup()
+	b, err := CreateBanList(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forever, _ := config.ParseNetwork("192.0.2.0/24")
+	hour, _ := config.ParseNetwork("2001:db8::1")
+	if _, err := b.Add(forever, 0, "abuse"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := b.Add(hour, time.Hour, "scanning"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// Adding the same network again replaces its ban, which moves it to the end
+	if _, err := b.Add(forever, 0, "more abuse"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("ban file has mode %s, want 0600", info.Mode().Perm())
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(file)); len(entries) != 1 {
+		t.Errorf("ban file directory has %d entries, want only the ban file", len(entries))
+	}
+	loaded, err := CreateBanList(file)
+	if err != nil {
+		t.Fatalf("CreateBanList() error = %v", err)
+	}
+	want, got := banStrings(b.List()), banStrings(loaded.List())
+	if len(want) != 2 || want[1] != "192.0.2.0/24 never more abuse" {
+		t.Fatalf("List() = %q, want the replaced ban last", want)
+	}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("loaded %q, want %q", got, want)
+	}
+	if removed, err := loaded.Remove(forever); !removed || err != nil {
+		t.Fatalf("Remove() = %t, %v", removed, err)
+	}
+	if removed, _ := loaded.Remove(forever); removed {
+		t.Error("Remove() found a ban that was already removed")
+	}
+	reloaded, err := CreateBanList(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := banStrings(reloaded.List()); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("loaded %q after removing a ban, want %q", got, want[:1])
+	}
+}
+
+func TestBanListFail(t *testing.T) {
+	b, err := CreateBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if ban, err := b.Fail("192.0.2.10", 3, time.Minute, time.Hour); ban != nil || err != nil {
+			t.Fatalf("failure %d banned %v, %v", i+1, ban, err)
+		}
+	}
+	if ban, _ := b.Fail("192.0.2.11", 3, time.Minute, time.Hour); ban != nil {
+		t.Fatal("another IP shares the failures")
+	}
+	ban, err := b.Fail("192.0.2.10", 3, time.Minute, time.Hour)
+	if ban == nil || err != nil {
+		t.Fatalf("third failure banned %v, %v", ban, err)
+	}
+	if b.Banned("192.0.2.10") == nil {
+		t.Error("banned IP is allowed to connect")
+	}
+	if b.Banned("192.0.2.11") != nil {
+		t.Error("IP that failed once is banned")
+	}
+	if ban, _ := b.Fail("192.0.2.12", 0, time.Minute, time.Hour); ban != nil {
+		t.Error("IP was banned without a limit")
+	}
+}
+
+func TestBanListFailWindow(t *testing.T) {
+	b, err := CreateBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Fail("192.0.2.10", 2, time.Minute, time.Hour)
+	// A failure outside of the window no longer counts
+	b.Failures["192.0.2.10"][0] = time.Now().Add(-2 * time.Minute)
+	if ban, _ := b.Fail("192.0.2.10", 2, time.Minute, time.Hour); ban != nil {
+		t.Error("failure outside of the window was counted")
+	}
+}
+
+func TestBanListFailForever(t *testing.T) {
+	b, err := CreateBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ban, err := b.Fail("192.0.2.10", 1, time.Minute, 0)
+	if ban == nil || err != nil {
+		t.Fatalf("failure banned %v, %v", ban, err)
+	}
+	if !ban.Expires.IsZero() {
+		t.Errorf("ban without a ban time expires at %s, want never", ban.Expires)
+	}
+}
@@ -3,141 +3,288 @@ package engine
 import (
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/logging"
+	"github.com/zachdeibert/protomux/metrics"
 )
 
 // Connection represents a client that has connected to this Listener
 type Connection struct {
 	Remote        *RemoteConnection
 	Engine        *Engine
+	Protocol      *Protocol
+	Matcher       framework.Matcher
 	LocalAddress  net.Addr
 	RemoteAddress net.Addr
 	Closed        bool
 	WaitGroup     sync.WaitGroup
-	Mutex         sync.Mutex
-	ReadBuffer    []byte
-	WriteBuffer   []byte
+	Offset        int
 	Priority      int
+	// Slot is whether the Connection holds a place in the Limit of its Protocol
+	Slot          bool
+	ReadDeadline  time.Time
+	WriteDeadline time.Time
+	ReadTimer     *time.Timer
+	Goodbye       func(reason string) error
+	Farewell      func(reason string) error
+	Log           *logging.Logger
+	Annotations   []logging.Field
+	BytesIn       *metrics.Value
+	BytesOut      *metrics.Value
 }
 
 // CreateConnection creates a new Connection
-func CreateConnection(remote *RemoteConnection, proto framework.ProtocolInstance, engine *Engine) *Connection {
+func CreateConnection(remote *RemoteConnection, proto *Protocol, engine *Engine) *Connection {
 	c := &Connection{
 		Remote:        remote,
 		Engine:        engine,
+		Protocol:      proto,
+		Matcher:       nil,
 		LocalAddress:  remote.Socket.LocalAddr(),
 		RemoteAddress: remote.Socket.RemoteAddr(),
 		Closed:        false,
-		ReadBuffer:    []byte{},
-		WriteBuffer:   []byte{},
+		Offset:        0,
 		Priority:      -1,
+		Slot:          false,
+		Goodbye:       nil,
+		Farewell:      nil,
+		Log:           remote.Log.With("protocol", proto.String()),
+		Annotations:   []logging.Field{},
+		BytesIn:       metricBytes.With(proto.Name, proto.RemoteName(), "in"),
+		BytesOut:      metricBytes.With(proto.Name, proto.RemoteName(), "out"),
 	}
+	if m, ok := proto.Instance.(framework.Matcher); ok {
+		c.Matcher = m
+	} else {
+		c.Start()
+	}
+	return c
+}
+
+// Start handling the Connection with its protocol
+func (c *Connection) Start() {
+	c.Matcher = nil
 	c.WaitGroup.Add(1)
 	go func() {
 		defer c.WaitGroup.Done()
-		if err := proto.Handle(c); err != nil && err != ErrorClosed {
-			c.Engine.NonCriticalError(err)
+		if err := c.Protocol.Instance.Handle(c); err != nil && err != ErrorClosed {
+			c.Remote.Mutex.Lock()
+			closed := c.Remote.Closed
+			exclusive := c.Remote.Exclusive == c
+			c.Remote.Mutex.Unlock()
+			if exclusive && !closed {
+				c.Log.Warningf("%s", framework.CountError(err))
+				c.Remote.Mutex.Lock()
+				c.Remote.setReason(err.Error())
+				c.Remote.Mutex.Unlock()
+			} else if !closed {
+				// Losing candidates failing is part of normal matching
+				c.Log.Debugf("%s", err)
+			}
 		}
 		c.Close()
 	}()
-	return c
 }
 
+// Read replays the data recorded by the RemoteConnection from this Connection's offset, then reads from the socket directly once this Connection is exclusive
 func (c *Connection) Read(b []byte) (int, error) {
-	c.Remote.Mutex.Lock()
-	for len(c.Remote.Connections) > 1 && len(c.ReadBuffer) == 0 && !c.Closed {
-		c.Remote.Cond.Wait()
-	}
-	if c.Closed {
-		c.Remote.Mutex.Unlock()
-		return 0, ErrorClosed
-	}
-	if len(c.ReadBuffer) > 0 {
-		l := len(b)
-		if l > len(c.ReadBuffer) {
-			l = len(c.ReadBuffer)
+	rc := c.Remote
+	rc.Mutex.Lock()
+	for {
+		if c.Closed || rc.Closed {
+			rc.Mutex.Unlock()
+			return 0, ErrorClosed
 		}
-		copy(b[:l], c.ReadBuffer[:l])
-		c.ReadBuffer = c.ReadBuffer[l:]
-		if len(c.ReadBuffer) == 0 {
-			c.Remote.Cond.Broadcast()
+		if c.Offset < len(rc.Buffer) {
+			n := copy(b, rc.Buffer[c.Offset:])
+			c.Offset += n
+			if rc.Exclusive == c {
+				c.BytesIn.Add(float64(n))
+			}
+			rc.Mutex.Unlock()
+			return n, nil
 		}
-		c.Remote.Mutex.Unlock()
-		return l, nil
+		if rc.ReadError != nil {
+			err := rc.ReadError
+			rc.Mutex.Unlock()
+			return 0, err
+		}
+		if rc.Exclusive == c && !rc.Reading {
+			break
+		}
+		if expired(c.ReadDeadline) {
+			rc.Mutex.Unlock()
+			return 0, ErrorTimeout
+		}
+		rc.Cond.Wait()
 	}
-	if len(c.Remote.Connections) == 1 {
-		c.Remote.Mutex.Unlock()
-		return c.Remote.Socket.Read(b)
+	// The recording has been fully replayed, so it is no longer needed
+	rc.Buffer = nil
+	c.Offset = 0
+	deadline := c.ReadDeadline
+	rc.Mutex.Unlock()
+	if err := rc.Socket.SetReadDeadline(deadline); err != nil {
+		return 0, err
 	}
-	panic("Control should never reach here")
+	n, err := rc.Socket.Read(b)
+	atomic.AddInt64(&rc.BytesRead, int64(n))
+	c.BytesIn.Add(float64(n))
+	return n, err
 }
 
+// Write sends data to the client, which is only allowed once this Connection is exclusive
 func (c *Connection) Write(b []byte) (int, error) {
-	c.Remote.Mutex.Lock()
-	c.WriteBuffer = b
-	c.Remote.Cond.Broadcast()
-	for len(c.Remote.Connections) > 1 && len(c.WriteBuffer) > 0 && !c.Closed {
-		c.Remote.Cond.Wait()
-	}
-	if c.Closed {
-		c.Remote.Mutex.Unlock()
+	rc := c.Remote
+	rc.Mutex.Lock()
+	if c.Closed || rc.Closed {
+		rc.Mutex.Unlock()
 		return 0, ErrorClosed
 	}
-	if len(c.Remote.Connections) == 1 {
-		c.Remote.Mutex.Unlock()
-		return c.Remote.Socket.Write(b)
+	if rc.Exclusive != c {
+		rc.Mutex.Unlock()
+		return 0, ErrorNotExclusive
 	}
-	if len(c.WriteBuffer) == 0 {
-		c.Remote.Mutex.Unlock()
-		return len(b), nil
+	deadline := c.WriteDeadline
+	rc.Mutex.Unlock()
+	if err := rc.Socket.SetWriteDeadline(deadline); err != nil {
+		return 0, err
 	}
-	panic("Control should never reach here")
+	n, err := rc.Socket.Write(b)
+	atomic.AddInt64(&rc.BytesWrote, int64(n))
+	c.BytesOut.Add(float64(n))
+	return n, err
 }
 
 // RequireExclusive notes that this Connection should be the only Connection on the RemoteConnection at this point
 func (c *Connection) RequireExclusive(priority int) error {
 	c.Remote.Mutex.Lock()
 	c.Priority = priority
+	c.Remote.Cond.Broadcast()
 	for {
+		if c.Remote.Exclusive != nil {
+			winner := c.Remote.Exclusive
+			c.Remote.Mutex.Unlock()
+			if winner == c {
+				return nil
+			}
+			c.Close()
+			return ErrorClosed
+		}
 		var winner *Connection = nil
 		maxPriority := -1
-		for _, c := range c.Remote.Connections {
-			if c.Priority < 0 {
+		for _, x := range c.Remote.Connections {
+			if x.Priority < 0 {
+				winner = nil
 				break
 			}
-			if c.Priority > maxPriority {
-				maxPriority = c.Priority
-				winner = c
+			if x.Priority > maxPriority {
+				maxPriority = x.Priority
+				winner = x
 			}
 		}
-		if winner == nil {
-			c.Remote.Cond.Wait()
-		} else {
+		if winner != nil {
+			c.Remote.MarkExclusive(winner)
+		} else if c.Closed || c.Remote.Closed {
 			c.Remote.Mutex.Unlock()
-			if winner == c {
-				return nil
-			}
-			c.Close()
 			return ErrorClosed
+		} else {
+			c.Remote.Cond.Wait()
 		}
 	}
 }
 
+// AcquireSlot takes a place in the Limit of the Protocol for the rest of the session
+func (c *Connection) AcquireSlot() error {
+	c.Remote.Mutex.Lock()
+	defer c.Remote.Mutex.Unlock()
+	if c.Remote.Exclusive != c {
+		return ErrorClosed
+	}
+	if c.Slot {
+		return nil
+	}
+	if c.Slot = c.Protocol.Limit.Acquire(clientIP(c.RemoteAddress), c.Protocol.MaxConnections, c.Protocol.MaxConnectionsPerIP); !c.Slot {
+		c.Log.Warningf("%s", framework.CountError(ErrorRemoteLimit(c.RemoteAddress, c.Protocol)))
+		c.Remote.setReason("remote full")
+		return framework.ErrorRemoteFull
+	}
+	return nil
+}
+
+// SetGoodbye sets the function that tells the client why it is being disconnected
+func (c *Connection) SetGoodbye(goodbye func(reason string) error) {
+	c.Remote.Mutex.Lock()
+	c.Goodbye = goodbye
+	c.Remote.Mutex.Unlock()
+}
+
+// SetFarewell sets the function that tells the client why its session is cut off at the end of the shutdown grace period
+func (c *Connection) SetFarewell(farewell func(reason string) error) {
+	c.Remote.Mutex.Lock()
+	c.Farewell = farewell
+	c.Remote.Mutex.Unlock()
+}
+
+// Logger gets the Logger for messages about this Connection
+func (c *Connection) Logger() *logging.Logger {
+	c.Remote.Mutex.Lock()
+	defer c.Remote.Mutex.Unlock()
+	return c.Log
+}
+
+// ProxyProtocol gets the version of the PROXY protocol header that the backend of the Protocol expects
+func (c *Connection) ProxyProtocol() string {
+	return c.Protocol.ProxyProtocol
+}
+
+// Annotate adds a field to the access log record and to later log messages about this Connection
+func (c *Connection) Annotate(key string, value interface{}) {
+	c.Remote.Mutex.Lock()
+	defer c.Remote.Mutex.Unlock()
+	c.Log = c.Log.With(key, value)
+	for i, f := range c.Annotations {
+		if f.Key == key {
+			c.Annotations[i].Value = value
+			return
+		}
+	}
+	c.Annotations = append(c.Annotations, logging.Field{
+		Key:   key,
+		Value: value,
+	})
+}
+
 // Close the Connection
 func (c *Connection) Close() error {
-	c.Mutex.Lock()
+	c.Remote.Mutex.Lock()
 	if !c.Closed {
 		c.Closed = true
-		c.Mutex.Unlock()
+		c.Remote.Cond.Broadcast()
+		c.Remote.Mutex.Unlock()
 		c.Remote.ReleaseConnection(c, &c.WaitGroup)
 	} else {
-		c.Mutex.Unlock()
+		c.Remote.Mutex.Unlock()
 	}
 	return nil
 }
 
+// CloseWrite shuts down the writing side of the socket once this Connection is exclusive
+func (c *Connection) CloseWrite() error {
+	c.Remote.Mutex.Lock()
+	exclusive := c.Remote.Exclusive == c && !c.Closed
+	c.Remote.Mutex.Unlock()
+	if !exclusive {
+		return ErrorNotExclusive
+	}
+	if cw, ok := c.Remote.Socket.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Close()
+}
+
 // LocalAddr returns the local network address
 func (c *Connection) LocalAddr() net.Addr {
 	return c.LocalAddress
@@ -148,17 +295,47 @@ func (c *Connection) RemoteAddr() net.Addr {
 	return c.RemoteAddress
 }
 
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
 // SetDeadline sets the read and write deadlines
 func (c *Connection) SetDeadline(t time.Time) error {
-	return ErrorDeadlinesNotSupported
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
 }
 
-// SetReadDeadline sets the read deadline
+// SetReadDeadline sets the read deadline, which wakes a Read waiting on the recording when it passes
 func (c *Connection) SetReadDeadline(t time.Time) error {
-	return ErrorDeadlinesNotSupported
+	c.Remote.Mutex.Lock()
+	defer c.Remote.Mutex.Unlock()
+	c.ReadDeadline = t
+	if c.ReadTimer != nil {
+		c.ReadTimer.Stop()
+		c.ReadTimer = nil
+	}
+	if !t.IsZero() {
+		c.ReadTimer = time.AfterFunc(time.Until(t), func() {
+			c.Remote.Mutex.Lock()
+			c.Remote.Cond.Broadcast()
+			c.Remote.Mutex.Unlock()
+		})
+	}
+	if c.Remote.Exclusive == c && !c.Closed {
+		return c.Remote.Socket.SetReadDeadline(t)
+	}
+	return nil
 }
 
 // SetWriteDeadline sets the write deadline
 func (c *Connection) SetWriteDeadline(t time.Time) error {
-	return ErrorDeadlinesNotSupported
+	c.Remote.Mutex.Lock()
+	defer c.Remote.Mutex.Unlock()
+	c.WriteDeadline = t
+	if c.Remote.Exclusive == c && !c.Closed {
+		return c.Remote.Socket.SetWriteDeadline(t)
+	}
+	return nil
 }
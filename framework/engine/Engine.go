@@ -1,66 +1,462 @@
 package engine
 
 import (
-	"fmt"
+	"crypto/tls"
+	"sync"
+	"time"
 
+	"github.com/zachdeibert/protomux/admin"
 	"github.com/zachdeibert/protomux/config"
 	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/logging"
+	"github.com/zachdeibert/protomux/metrics"
 )
 
+// shutdownReason is what clients are told when they are disconnected because the Engine is stopping
+const shutdownReason = "Proxy restarting"
+
 // Engine runs the main part of the program
 type Engine struct {
-	Services []*Service
+	Config    config.Config
+	Services  []*Service
+	Log       *logging.Logger
+	Access    *logging.Logger
+	Metrics   *metrics.Server
+	Admin     *admin.Server
+	Bans      *BanList
+	Inherited *Inherited
+	NextID    uint64
+	Mutex     sync.Mutex
 }
 
 // CreateEngine creates a new Engine
 func CreateEngine(cfg config.Config) (*Engine, error) {
+	output, err := logging.CreateOutput(cfg.Log.Level, cfg.Log.Format, cfg.Log.File)
+	if err != nil {
+		return nil, err
+	}
+	accessLog := cfg.Log.Access()
+	access, err := logging.CreateOutput(accessLog.Level, accessLog.Format, accessLog.File)
+	if err != nil {
+		return nil, err
+	}
+	bans, err := CreateBanList(cfg.BanFile)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := InheritSockets()
+	if err != nil {
+		return nil, err
+	}
 	eng := &Engine{
-		Services: []*Service{},
+		Config:    cfg,
+		Services:  []*Service{},
+		Log:       logging.CreateLogger(output),
+		Access:    logging.CreateLogger(access),
+		Metrics:   nil,
+		Admin:     nil,
+		Bans:      bans,
+		Inherited: inherited,
+		NextID:    0,
 	}
 	for _, srv := range cfg.Services {
-		protos := []framework.ProtocolInstance{}
-		for _, p := range srv.Protocols {
-			impl, ok := framework.Protocols[p.Name]
-			if !ok {
-				return nil, ErrorUnknownProtocol(p.Name)
-			}
-			for _, remote := range p.Remotes {
-				inst, err := impl.Configure(p.Parameters, remote.Name, remote.Parameters)
-				if err != nil {
-					return nil, err
-				}
-				protos = append(protos, inst)
-			}
+		protos, err := ConfigureProtocols(srv)
+		if err != nil {
+			return nil, err
 		}
-		s, err := CreateService(srv.ListenAddresses, protos, eng)
+		tlsConfig, err := ConfigureTLS(srv)
+		if err != nil {
+			return nil, err
+		}
+		s, err := CreateService(srv, protos, tlsConfig, eng)
 		if err != nil {
 			return nil, err
 		}
 		eng.Services = append(eng.Services, s)
 	}
+	// Sockets that are not claimed now would only hold their addresses without anybody accepting on them
+	inherited.CloseUnused(eng.Log)
+	if cfg.Metrics != nil {
+		if eng.Metrics, err = metrics.CreateServer(cfg.Metrics.ListenAddresses, metrics.Default); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Admin != nil {
+		if eng.Admin, err = admin.CreateServer(cfg.Admin.Socket, eng); err != nil {
+			return nil, err
+		}
+	}
+	metrics.Default.GaugeFunc("protomux_active_connections", "Connections that are currently open on each service", eng.activeConnections, "service")
 	return eng, nil
 }
 
+// activeConnections counts the open connections on each Service for the metrics
+func (e *Engine) activeConnections() []metrics.Sample {
+	services, listeners := e.snapshot()
+	samples := []metrics.Sample{}
+	for i, s := range services {
+		name := s.Name()
+		flows := 0
+		for _, l := range listeners[i] {
+			flows += len(l.FlowList())
+		}
+		s.Mutex.Lock()
+		samples = append(samples, metrics.Sample{
+			Labels: []string{name},
+			Value:  float64(len(s.Remotes) + flows),
+		})
+		s.Mutex.Unlock()
+	}
+	return samples
+}
+
+// reloadMetrics moves the metrics endpoint if its addresses have changed
+func (e *Engine) reloadMetrics(cfg *config.Metrics) error {
+	old := ""
+	if e.Config.Metrics != nil {
+		old = e.Config.Metrics.String()
+	}
+	new := ""
+	if cfg != nil {
+		new = cfg.String()
+	}
+	if old == new {
+		return nil
+	}
+	if cfg == nil {
+		if e.Metrics != nil {
+			e.Metrics.Stop()
+			e.Metrics = nil
+		}
+		return nil
+	}
+	// The new endpoint is opened first so that scrapes keep working if it cannot be
+	m, err := metrics.CreateServer(cfg.ListenAddresses, metrics.Default)
+	if err != nil && e.Metrics != nil {
+		// The new addresses may include one of the old ones, which has to be closed before it can be opened again
+		addresses := e.Metrics.Addresses
+		e.Metrics.Stop()
+		e.Metrics = nil
+		if m, err = metrics.CreateServer(cfg.ListenAddresses, metrics.Default); err != nil {
+			if prev, perr := metrics.CreateServer(addresses, metrics.Default); perr == nil {
+				e.Metrics = prev
+				prev.Start()
+			}
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if e.Metrics != nil {
+		e.Metrics.Stop()
+	}
+	e.Metrics = m
+	m.Start()
+	return nil
+}
+
+// reloadAdmin moves the admin socket if its path has changed
+func (e *Engine) reloadAdmin(cfg *config.Admin) error {
+	old := ""
+	if e.Config.Admin != nil {
+		old = e.Config.Admin.Socket
+	}
+	new := ""
+	if cfg != nil {
+		new = cfg.Socket
+	}
+	if old == new {
+		return nil
+	}
+	if e.Admin != nil {
+		e.Admin.Stop()
+		e.Admin = nil
+	}
+	if cfg == nil {
+		return nil
+	}
+	a, err := admin.CreateServer(cfg.Socket, e)
+	if err != nil {
+		return err
+	}
+	e.Admin = a
+	a.Start()
+	return nil
+}
+
+// ConfigureProtocols creates the protocol instances for every remote in a service
+func ConfigureProtocols(srv config.Service) ([]*Protocol, error) {
+	protos := []*Protocol{}
+	for _, p := range srv.Protocols {
+		impl, ok := framework.Protocols[p.Name]
+		if !ok {
+			return nil, ErrorUnknownProtocol(p.Name)
+		}
+		for i, remote := range p.Remotes {
+			inst, err := impl.Configure(p.ProtocolParameters(), remote.Name, remote.ProtocolParameters())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := inst.(framework.DatagramHandler); !ok && srv.Network == "udp" {
+				return nil, ErrorNotDatagram(p.Name)
+			}
+			protos = append(protos, &Protocol{
+				Name:                p.Name,
+				Remote:              remote.Name,
+				Index:               i,
+				Instance:            inst,
+				MaxConnections:      remote.MaxConnections,
+				MaxConnectionsPerIP: remote.MaxConnectionsPerIP,
+				Limit:               CreateLimit(),
+				ACL:                 remote.ACL.Then(p.ACL),
+				ProxyProtocol:       remote.ProxyProtocol,
+			})
+		}
+	}
+	return protos, nil
+}
+
+// Reload applies a new configuration to the running Engine without closing existing connections
+//
+// Every new listener is opened before the old ones are closed, so if one of them cannot be opened the Engine keeps listening as it was.
+func (e *Engine) Reload(cfg config.Config) error {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	protos := make([][]*Protocol, len(cfg.Services))
+	tlsConfigs := make([]*tls.Config, len(cfg.Services))
+	for i, srv := range cfg.Services {
+		var err error
+		if protos[i], err = ConfigureProtocols(srv); err != nil {
+			return err
+		}
+		// Certificates are read again on every reload so that renewed ones are picked up
+		if tlsConfigs[i], err = ConfigureTLS(srv); err != nil {
+			return err
+		}
+	}
+	// The log files are opened now but only switched to once the listeners and services are set up
+	output, err := logging.CreateOutput(cfg.Log.Level, cfg.Log.Format, cfg.Log.File)
+	if err != nil {
+		return err
+	}
+	accessLog := cfg.Log.Access()
+	access, err := logging.CreateOutput(accessLog.Level, accessLog.Format, accessLog.File)
+	if err != nil {
+		output.Close()
+		return err
+	}
+	owners := map[string]*Service{}
+	listeners := map[string]*Listener{}
+	for _, s := range e.Services {
+		for _, l := range s.ListenerList() {
+			owners[l.Address.String()] = s
+			listeners[l.key()] = l
+		}
+	}
+	// Each new service takes over the old service that was listening on one of its addresses
+	services := make([]*Service, len(cfg.Services))
+	claimed := map[*Service]bool{}
+	for i, srv := range cfg.Services {
+		for _, addr := range srv.ListenAddresses {
+			if s, ok := owners[addr.String()]; ok && !claimed[s] {
+				services[i] = s
+				claimed[s] = true
+				break
+			}
+		}
+		if services[i] == nil {
+			services[i] = &Service{
+				Config:     srv,
+				Protocols:  protos[i],
+				Listeners:  []*Listener{},
+				Engine:     e,
+				Remotes:    []*RemoteConnection{},
+				Limit:      CreateLimit(),
+				IPRate:     CreateRateLimiter(),
+				SubnetRate: CreateRateLimiter(),
+				Log:        e.Log,
+				Retired:    false,
+			}
+			services[i].Cond = sync.NewCond(&services[i].Mutex)
+		}
+	}
+	// Sockets are kept when the same service needs them again, and addresses that are still in use by a socket that is not kept are only opened once it is closed
+	keep := map[*Listener]bool{}
+	busy := map[*Listener]bool{}
+	opened := make([][]*Listener, len(cfg.Services))
+	later := make([][]config.Connection, len(cfg.Services))
+	for i, srv := range cfg.Services {
+		for _, addr := range srv.ListenAddresses {
+			if l, ok := listeners[socketKey(addr, srv.Network, srv.IPv6Only)]; ok && l.Service == services[i] {
+				keep[l] = true
+			} else if s, ok := owners[addr.String()]; ok {
+				for _, l := range s.ListenerList() {
+					if l.Address.String() == addr.String() {
+						busy[l] = true
+					}
+				}
+				later[i] = append(later[i], addr)
+			} else if err == nil {
+				var l *Listener
+				if l, err = CreateListener(addr, srv, services[i], e); err == nil {
+					opened[i] = append(opened[i], l)
+				}
+			}
+		}
+	}
+	if err == nil && len(busy) > 0 {
+		err = e.rebind(cfg, services, opened, later, busy)
+	}
+	if err != nil {
+		for _, ls := range opened {
+			for _, l := range ls {
+				l.close()
+			}
+		}
+		output.Close()
+		access.Close()
+		return err
+	}
+	for _, s := range e.Services {
+		s.StopListeners(keep)
+	}
+	for i, srv := range cfg.Services {
+		services[i].Reconfigure(srv, protos[i], tlsConfigs[i], opened[i])
+	}
+	e.Log.Output.Replace(output)
+	e.Access.Output.Replace(access)
+	// Services that were removed are kept until their connections finish
+	for _, s := range e.Services {
+		if !claimed[s] {
+			s.Mutex.Lock()
+			if len(s.Remotes) > 0 {
+				s.Retired = true
+				services = append(services, s)
+			}
+			s.Mutex.Unlock()
+		}
+	}
+	e.Services = services
+	var firstErr error
+	if err := e.reloadMetrics(cfg.Metrics); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := e.reloadAdmin(cfg.Admin); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := e.Bans.SetFile(cfg.BanFile); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	e.Config = cfg
+	return firstErr
+}
+
+// rebind closes the old listeners that are in the way of new ones and opens the new ones in their place, reopening the old ones if that fails
+func (e *Engine) rebind(cfg config.Config, services []*Service, opened [][]*Listener, later [][]config.Connection, busy map[*Listener]bool) error {
+	others := map[*Listener]bool{}
+	for _, s := range e.Services {
+		for _, l := range s.ListenerList() {
+			if !busy[l] {
+				others[l] = true
+			}
+		}
+	}
+	stopped := []*Listener{}
+	for _, s := range e.Services {
+		stopped = append(stopped, s.StopListeners(others)...)
+	}
+	var err error
+	for i, srv := range cfg.Services {
+		for _, addr := range later[i] {
+			if err != nil {
+				break
+			}
+			var l *Listener
+			if l, err = CreateListener(addr, srv, services[i], e); err == nil {
+				opened[i] = append(opened[i], l)
+			}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	for _, old := range stopped {
+		l, rerr := CreateListener(old.Address, old.Service.Config, old.Service, e)
+		if rerr != nil {
+			e.Log.Errorf("Unable to listen on %s again: %s", old.Address, framework.CountError(rerr))
+			continue
+		}
+		old.Service.AddListener(l)
+	}
+	return err
+}
+
+// prune removes a Service that is no longer configured once its last connection has finished
+func (e *Engine) prune(s *Service) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	n := 0
+	for _, x := range e.Services {
+		if x != s {
+			e.Services[n] = x
+			n++
+		}
+	}
+	e.Services = e.Services[:n]
+}
+
 // Start starts the Engine
 func (e *Engine) Start() {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
 	for _, s := range e.Services {
 		s.Start()
 	}
+	if e.Metrics != nil {
+		e.Metrics.Start()
+	}
+	if e.Admin != nil {
+		e.Admin.Start()
+	}
+	e.Inherited.NotifyReady()
 }
 
-// Stop stops the Engine
-func (e *Engine) Stop() {
+// Drain stops accepting connections and waits up to the grace period for the existing ones to finish
+func (e *Engine) Drain(grace time.Duration, abort <-chan struct{}) {
+	e.Mutex.Lock()
 	for _, s := range e.Services {
-		s.Stop()
+		s.Drain(shutdownReason)
+	}
+	services := e.Services
+	e.Mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		for _, s := range services {
+			s.Wait()
+		}
+		close(done)
+	}()
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-abort:
 	}
 }
 
-// NonCriticalError handles a non-critical error
-func (e *Engine) NonCriticalError(err error) {
-	fmt.Println(err)
-}
-
-// NormalError handles an error that isn't critical, but also is more severe than other non-critical errors
-func (e *Engine) NormalError(err error) {
-	fmt.Println(err)
+// Stop stops the Engine
+func (e *Engine) Stop() {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	for _, s := range e.Services {
+		s.Stop(shutdownReason)
+	}
+	if e.Metrics != nil {
+		e.Metrics.Stop()
+	}
+	if e.Admin != nil {
+		e.Admin.Stop()
+	}
 }
@@ -2,6 +2,8 @@ package engine
 
 import (
 	"fmt"
+	"net"
+	"time"
 
 	"github.com/zachdeibert/protomux/config"
 )
@@ -20,10 +22,96 @@ const (
 	ErrorCodeListenStart ErrorCode = iota
 	// ErrorCodeClosed represents when the socket has been closed
 	ErrorCodeClosed ErrorCode = iota
-	// ErrorCodeDeadlinesNotSupported is returned when a deadline is attempted to be set
-	ErrorCodeDeadlinesNotSupported ErrorCode = iota
+	// ErrorCodeTimeout represents when a deadline passed before an operation completed
+	ErrorCodeTimeout ErrorCode = iota
+	// ErrorCodeNotExclusive represents when an operation requires the Connection to be the only Connection on its RemoteConnection
+	ErrorCodeNotExclusive ErrorCode = iota
+	// ErrorCodeMatchTimeout represents when no protocol claimed a connection before the match timeout
+	ErrorCodeMatchTimeout ErrorCode = iota
+	// ErrorCodeMatchTooSlow represents when a client sent too little data while the protocols were being matched
+	ErrorCodeMatchTooSlow ErrorCode = iota
+	// ErrorCodeBufferLimit represents when a client sent more data than can be recorded while the protocols were being matched
+	ErrorCodeBufferLimit ErrorCode = iota
+	// ErrorCodeServiceLimit represents when a connection was refused because the Service is at a connection limit
+	ErrorCodeServiceLimit ErrorCode = iota
+	// ErrorCodeRemoteLimit represents when a matched connection was refused because its remote is at a connection limit
+	ErrorCodeRemoteLimit ErrorCode = iota
+	// ErrorCodeRateLimit represents when a connection was refused because its source opened too many connections recently
+	ErrorCodeRateLimit ErrorCode = iota
+	// ErrorCodeBanned represents when a connection was refused because its source is banned
+	ErrorCodeBanned ErrorCode = iota
+	// ErrorCodeBanFile represents when the ban list could not be read from or written to its file
+	ErrorCodeBanFile ErrorCode = iota
+	// ErrorCodeBanFileSyntax represents when a line in the ban file cannot be understood
+	ErrorCodeBanFileSyntax ErrorCode = iota
+	// ErrorCodeNotAllowed represents when a connection was refused because the Service does not allow its source
+	ErrorCodeNotAllowed ErrorCode = iota
+	// ErrorCodeUntrustedProxy represents when a connection was refused because it is not from a trusted proxy
+	ErrorCodeUntrustedProxy ErrorCode = iota
+	// ErrorCodeProxyHeader represents when a connection from a proxy did not start with a valid PROXY protocol header
+	ErrorCodeProxyHeader ErrorCode = iota
+	// ErrorCodeNotDatagram represents when a protocol that cannot handle datagrams is used on a udp Service
+	ErrorCodeNotDatagram ErrorCode = iota
+	// ErrorCodeFlowBackend represents when a datagram flow could not be forwarded to its backend
+	ErrorCodeFlowBackend ErrorCode = iota
+	// ErrorCodeInheritedSocket represents when a file descriptor that was passed to the process is not a usable socket
+	ErrorCodeInheritedSocket ErrorCode = iota
+	// ErrorCodeNotInherited represents when a listen address names a socket that was not passed to the process
+	ErrorCodeNotInherited ErrorCode = iota
+	// ErrorCodeInheritedType represents when an inherited socket is a stream socket on a udp Service or the other way around
+	ErrorCodeInheritedType ErrorCode = iota
+	// ErrorCodeUpgrade represents when the listeners could not be handed over to a new process
+	ErrorCodeUpgrade ErrorCode = iota
+	// ErrorCodeNotFile represents when a listening socket cannot be passed to another process
+	ErrorCodeNotFile ErrorCode = iota
+	// ErrorCodeCertificate represents when a certificate or its private key cannot be loaded
+	ErrorCodeCertificate ErrorCode = iota
+	// ErrorCodeTLSHandshake represents when a client does not finish the TLS handshake
+	ErrorCodeTLSHandshake ErrorCode = iota
+	// ErrorCodeNotify represents when the service manager could not be told about the new process after an upgrade
+	ErrorCodeNotify ErrorCode = iota
 )
 
+// errorCodeNames are the names of each ErrorCode in the metrics, in the same order as the constants
+var errorCodeNames = []string{
+	"unknown_protocol",
+	"host_lookup",
+	"no_host_records",
+	"listen_start",
+	"closed",
+	"timeout",
+	"not_exclusive",
+	"match_timeout",
+	"match_too_slow",
+	"buffer_limit",
+	"service_limit",
+	"remote_limit",
+	"rate_limit",
+	"banned",
+	"ban_file",
+	"ban_file_syntax",
+	"not_allowed",
+	"untrusted_proxy",
+	"proxy_header",
+	"not_datagram",
+	"flow_backend",
+	"inherited_socket",
+	"not_inherited",
+	"inherited_type",
+	"upgrade",
+	"not_file",
+	"certificate",
+	"tls_handshake",
+	"notify",
+}
+
+func (c ErrorCode) String() string {
+	if c < 0 || int(c) >= len(errorCodeNames) {
+		return "unknown"
+	}
+	return errorCodeNames[c]
+}
+
 // Error describes an engine error
 type Error struct {
 	Message string
@@ -34,6 +122,21 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// Count the error in the metrics
+func (e Error) Count() {
+	metricErrors.Inc(e.Code.String())
+}
+
+// Timeout returns whether the error was caused by a deadline passing
+func (e Error) Timeout() bool {
+	return e.Code == ErrorCodeTimeout
+}
+
+// Temporary returns whether retrying the operation may succeed
+func (e Error) Temporary() bool {
+	return e.Code == ErrorCodeTimeout
+}
+
 // ErrorUnknownProtocol creates a new ErrorUnknownProtocol error
 func ErrorUnknownProtocol(name string) error {
 	return &Error{
@@ -71,8 +174,190 @@ var ErrorClosed error = &Error{
 	Code:    ErrorCodeClosed,
 }
 
-// ErrorDeadlinesNotSupported error
-var ErrorDeadlinesNotSupported error = &Error{
-	Message: "Setting deadlines is not supported",
-	Code:    ErrorCodeDeadlinesNotSupported,
+// ErrorTimeout error
+var ErrorTimeout error = &Error{
+	Message: "Deadline exceeded",
+	Code:    ErrorCodeTimeout,
+}
+
+// ErrorNotExclusive error
+var ErrorNotExclusive error = &Error{
+	Message: "Connection is not exclusive",
+	Code:    ErrorCodeNotExclusive,
+}
+
+// ErrorMatchTimeout creates a new ErrorMatchTimeout error
+func ErrorMatchTimeout(addr net.Addr, timeout time.Duration) error {
+	return &Error{
+		Message: fmt.Sprintf("No protocol matched connection from %s within %s", addr, timeout),
+		Code:    ErrorCodeMatchTimeout,
+	}
+}
+
+// ErrorMatchTooSlow creates a new ErrorMatchTooSlow error
+func ErrorMatchTooSlow(addr net.Addr, bytes int64, interval time.Duration) error {
+	return &Error{
+		Message: fmt.Sprintf("Connection from %s sent only %d bytes in %s while matching", addr, bytes, interval),
+		Code:    ErrorCodeMatchTooSlow,
+	}
+}
+
+// ErrorBufferLimit creates a new ErrorBufferLimit error
+func ErrorBufferLimit(addr net.Addr, limit int) error {
+	return &Error{
+		Message: fmt.Sprintf("Connection from %s sent more than %d bytes without being matched", addr, limit),
+		Code:    ErrorCodeBufferLimit,
+	}
+}
+
+// ErrorServiceLimit creates a new ErrorServiceLimit error
+func ErrorServiceLimit(addr net.Addr) error {
+	return &Error{
+		Message: fmt.Sprintf("Refusing connection from %s because the service is at its connection limit", addr),
+		Code:    ErrorCodeServiceLimit,
+	}
+}
+
+// ErrorRemoteLimit creates a new ErrorRemoteLimit error
+func ErrorRemoteLimit(addr net.Addr, proto *Protocol) error {
+	return &Error{
+		Message: fmt.Sprintf("Refusing connection from %s because %s is at its connection limit", addr, proto),
+		Code:    ErrorCodeRemoteLimit,
+	}
+}
+
+// ErrorRateLimit creates a new ErrorRateLimit error
+func ErrorRateLimit(addr net.Addr, source string) error {
+	return &Error{
+		Message: fmt.Sprintf("Refusing connection from %s because %s is opening connections too quickly", addr, source),
+		Code:    ErrorCodeRateLimit,
+	}
+}
+
+// ErrorBanned creates a new ErrorBanned error
+func ErrorBanned(addr net.Addr, ban *Ban) error {
+	return &Error{
+		Message: fmt.Sprintf("Refusing connection from %s because %s is banned", addr, ban.Network),
+		Code:    ErrorCodeBanned,
+	}
+}
+
+// ErrorBanFile creates a new ErrorBanFile error
+func ErrorBanFile(file string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to use ban file %s: %s", file, err),
+		Code:    ErrorCodeBanFile,
+	}
+}
+
+// ErrorBanFileSyntax creates a new ErrorBanFileSyntax error
+func ErrorBanFileSyntax(file string, line int) error {
+	return &Error{
+		Message: fmt.Sprintf("Invalid ban on line %d of %s", line, file),
+		Code:    ErrorCodeBanFileSyntax,
+	}
+}
+
+// ErrorNotAllowed creates a new ErrorNotAllowed error
+func ErrorNotAllowed(addr net.Addr) error {
+	return &Error{
+		Message: fmt.Sprintf("Refusing connection from %s because the service does not allow it", addr),
+		Code:    ErrorCodeNotAllowed,
+	}
+}
+
+// ErrorUntrustedProxy creates a new ErrorUntrustedProxy error
+func ErrorUntrustedProxy(addr net.Addr) error {
+	return &Error{
+		Message: fmt.Sprintf("Refusing connection from %s because it is not a trusted proxy", addr),
+		Code:    ErrorCodeUntrustedProxy,
+	}
+}
+
+// ErrorProxyHeader creates a new ErrorProxyHeader error
+func ErrorProxyHeader(addr net.Addr, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to read PROXY protocol header from %s: %s", addr, err),
+		Code:    ErrorCodeProxyHeader,
+	}
+}
+
+// ErrorNotDatagram creates a new ErrorNotDatagram error
+func ErrorNotDatagram(name string) error {
+	return &Error{
+		Message: fmt.Sprintf("Protocol '%s' cannot handle datagrams", name),
+		Code:    ErrorCodeNotDatagram,
+	}
+}
+
+// ErrorFlowBackend creates a new ErrorFlowBackend error
+func ErrorFlowBackend(addr net.Addr, backend *net.UDPAddr, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to forward flow from %s to %s: %s", addr, backend, err),
+		Code:    ErrorCodeFlowBackend,
+	}
+}
+
+// ErrorInheritedSocket creates a new ErrorInheritedSocket error
+func ErrorInheritedSocket(name string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to use inherited socket %s: %s", name, err),
+		Code:    ErrorCodeInheritedSocket,
+	}
+}
+
+// ErrorNotInherited creates a new ErrorNotInherited error
+func ErrorNotInherited(name string) error {
+	return &Error{
+		Message: fmt.Sprintf("No socket named '%s' was passed to the process", name),
+		Code:    ErrorCodeNotInherited,
+	}
+}
+
+// ErrorInheritedType creates a new ErrorInheritedType error
+func ErrorInheritedType(sock *InheritedSocket, network string) error {
+	return &Error{
+		Message: fmt.Sprintf("Inherited socket %s cannot be used by a %s service", sock, network),
+		Code:    ErrorCodeInheritedType,
+	}
+}
+
+// ErrorUpgrade creates a new ErrorUpgrade error
+func ErrorUpgrade(err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to hand listeners over to a new process: %s", err),
+		Code:    ErrorCodeUpgrade,
+	}
+}
+
+// ErrorNotFile creates a new ErrorNotFile error
+func ErrorNotFile(addr config.Connection) error {
+	return &Error{
+		Message: fmt.Sprintf("Listener on %s cannot be passed to another process", addr),
+		Code:    ErrorCodeNotFile,
+	}
+}
+
+// ErrorCertificate creates a new ErrorCertificate error
+func ErrorCertificate(file string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to load certificate %s: %s", file, err),
+		Code:    ErrorCodeCertificate,
+	}
+}
+
+// ErrorTLSHandshake creates a new ErrorTLSHandshake error
+func ErrorTLSHandshake(addr net.Addr, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("TLS handshake with %s failed: %s", addr, err),
+		Code:    ErrorCodeTLSHandshake,
+	}
+}
+
+// ErrorNotify creates a new ErrorNotify error
+func ErrorNotify(pid int, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to tell systemd that process %d is now the main process: %s", pid, err),
+		Code:    ErrorCodeNotify,
+	}
 }
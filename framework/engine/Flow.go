@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/logging"
+	"github.com/zachdeibert/protomux/metrics"
+)
+
+// datagramSize is big enough to hold any UDP datagram
+const datagramSize = 65535
+
+// Flow forwards the datagrams from one client to the backend that its first datagram matched
+type Flow struct {
+	ID         uint64
+	Client     *net.UDPAddr
+	Packets    *net.UDPConn
+	Protocol   *Protocol
+	Backend    *net.UDPConn
+	Listener   *Listener
+	Timeout    time.Duration
+	Accepted   time.Time
+	Active     int64
+	BytesRead  int64
+	BytesWrote int64
+	BytesIn    *metrics.Value
+	BytesOut   *metrics.Value
+	Reason     string
+	Closed     bool
+	Mutex      sync.Mutex
+	Log        *logging.Logger
+}
+
+// CreateFlow creates a new Flow and connects it to the backend of its Protocol
+func CreateFlow(client *net.UDPAddr, packets *net.UDPConn, proto *Protocol, listener *Listener, log *logging.Logger) (*Flow, error) {
+	addr := proto.Instance.(framework.DatagramHandler).DatagramBackend()
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, ErrorFlowBackend(client, addr, err)
+	}
+	id := atomic.AddUint64(&listener.Engine.NextID, 1)
+	now := time.Now()
+	f := &Flow{
+		ID:         id,
+		Client:     client,
+		Packets:    packets,
+		Protocol:   proto,
+		Backend:    conn,
+		Listener:   listener,
+		Timeout:    listener.Service.Config.FlowTimeout,
+		Accepted:   now,
+		Active:     now.UnixNano(),
+		BytesRead:  0,
+		BytesWrote: 0,
+		BytesIn:    metricBytes.With(proto.Name, proto.RemoteName(), "in"),
+		BytesOut:   metricBytes.With(proto.Name, proto.RemoteName(), "out"),
+		Reason:     "",
+		Closed:     false,
+		Log:        log.With("id", id).With("client", client.String()).With("protocol", proto.String()),
+	}
+	f.Log.With("backend", addr.String()).Infof("Protocol matched")
+	return f, nil
+}
+
+// Start relaying the replies from the backend to the client
+func (f *Flow) Start() {
+	go f.relay()
+}
+
+// Forward a datagram from the client to the backend
+func (f *Flow) Forward(datagram []byte) {
+	// Holding the Mutex while writing keeps CloseFor from closing the backend socket underneath the write
+	f.Mutex.Lock()
+	defer f.Mutex.Unlock()
+	if f.Closed {
+		return
+	}
+	atomic.StoreInt64(&f.Active, time.Now().UnixNano())
+	n, err := f.Backend.Write(datagram)
+	if err != nil {
+		f.Log.Debugf("Unable to forward datagram: %s", err)
+		return
+	}
+	atomic.AddInt64(&f.BytesRead, int64(n))
+	f.BytesIn.Add(float64(n))
+}
+
+// relay copies datagrams from the backend to the client until the Flow is idle for longer than its Timeout
+func (f *Flow) relay() {
+	buffer := make([]byte, datagramSize)
+	for {
+		f.Backend.SetReadDeadline(time.Now().Add(f.Timeout))
+		n, err := f.Backend.Read(buffer)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				// The client may have kept the Flow alive without the backend replying
+				if time.Since(time.Unix(0, atomic.LoadInt64(&f.Active))) < f.Timeout {
+					continue
+				}
+				f.CloseFor("idle")
+			} else {
+				f.Mutex.Lock()
+				closed := f.Closed
+				f.Mutex.Unlock()
+				if !closed {
+					f.Log.Debugf("Unable to receive datagram from backend: %s", err)
+				}
+				f.CloseFor("backend closed")
+			}
+			return
+		}
+		atomic.StoreInt64(&f.Active, time.Now().UnixNano())
+		if n, err = f.Packets.WriteToUDP(buffer[:n], f.Client); err != nil {
+			f.Log.Debugf("Unable to send datagram to client: %s", err)
+			continue
+		}
+		atomic.AddInt64(&f.BytesWrote, int64(n))
+		f.BytesOut.Add(float64(n))
+	}
+}
+
+// CloseFor closes the Flow and records why in the access log
+func (f *Flow) CloseFor(reason string) {
+	f.Mutex.Lock()
+	if f.Closed {
+		f.Mutex.Unlock()
+		return
+	}
+	f.Closed = true
+	f.Reason = reason
+	f.Mutex.Unlock()
+	if err := f.Backend.Close(); err != nil {
+		f.Log.Debugf("Unable to close socket: %s", err)
+	}
+	f.Listener.ReleaseFlow(f)
+	ip := clientIP(f.Client)
+	f.Protocol.Limit.Release(ip)
+	f.Listener.Service.Limit.Release(ip)
+	f.access()
+}
+
+// access writes the access log record for the Flow once it has been closed
+func (f *Flow) access() {
+	f.Listener.Engine.Access.
+		With("id", f.ID).
+		With("accepted", f.Accepted.UTC().Format(time.RFC3339Nano)).
+		With("client", f.Client.String()).
+		With("listener", f.Listener.Address.String()).
+		With("protocol", f.Protocol.String()).
+		With("bytesIn", atomic.LoadInt64(&f.BytesRead)).
+		With("bytesOut", atomic.LoadInt64(&f.BytesWrote)).
+		With("duration", time.Since(f.Accepted).String()).
+		With("reason", f.Reason).
+		Infof("Flow closed")
+}
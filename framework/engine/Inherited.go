@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/logging"
+)
+
+// listenFDsStart is the first file descriptor that systemd passes sockets on
+const listenFDsStart = 3
+
+// upgradePIDVariable names the environment variable that holds the process ID of the instance that started this one in an upgrade
+const upgradePIDVariable = "PROTOMUX_UPGRADE_PID"
+
+// readyFDVariable names the environment variable that holds the file descriptor that this instance reports that it is ready on
+const readyFDVariable = "PROTOMUX_READY_FD"
+
+// InheritedSocket is a listening socket that was passed to the process when it started
+type InheritedSocket struct {
+	Name     string
+	Listener net.Listener
+	Packets  *net.UDPConn
+	Used     bool
+}
+
+// Inherited holds the listening sockets that were passed to the process by systemd or by the instance that it is replacing
+type Inherited struct {
+	Sockets []*InheritedSocket
+	Ready   *os.File
+	Mutex   sync.Mutex
+}
+
+// InheritSockets takes the sockets that were passed to the process in the LISTEN_FDS environment variables
+func InheritSockets() (*Inherited, error) {
+	inh := &Inherited{
+		Sockets: []*InheritedSocket{},
+		Ready:   nil,
+	}
+	// The variables are meant for this process alone, so they must not be passed on to anything it starts
+	defer func() {
+		for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", upgradePIDVariable, readyFDVariable} {
+			os.Unsetenv(name)
+		}
+	}()
+	if fd, err := strconv.Atoi(os.Getenv(readyFDVariable)); err == nil && os.Getenv(upgradePIDVariable) == strconv.Itoa(os.Getppid()) {
+		inh.Ready = os.NewFile(uintptr(fd), "ready")
+	}
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) && os.Getenv(upgradePIDVariable) != strconv.Itoa(os.Getppid()) {
+		return inh, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return inh, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(listenFDsStart+i), name)
+		sock := &InheritedSocket{
+			Name: name,
+			Used: false,
+		}
+		// Both calls duplicate the descriptor, so the original is closed either way
+		if sock.Listener, err = net.FileListener(file); err != nil {
+			packets, perr := net.FilePacketConn(file)
+			udp, ok := packets.(*net.UDPConn)
+			if perr != nil || !ok {
+				if perr == nil {
+					packets.Close()
+				}
+				file.Close()
+				inh.Close()
+				return nil, ErrorInheritedSocket(name, err)
+			}
+			sock.Packets = udp
+		}
+		file.Close()
+		inh.Sockets = append(inh.Sockets, sock)
+	}
+	return inh, nil
+}
+
+// Take claims the unused socket for a listen address, returning nil if no socket was inherited for it
+//
+// Addresses from systemd are matched by name and everything else is matched by the address that the socket is bound to.
+func (inh *Inherited) Take(address config.Connection, ip net.IP) *InheritedSocket {
+	inh.Mutex.Lock()
+	defer inh.Mutex.Unlock()
+	for _, sock := range inh.Sockets {
+		if !sock.Used && sock.matches(address, ip) {
+			sock.Used = true
+			return sock
+		}
+	}
+	return nil
+}
+
+// matches determines if the socket is the one for a listen address
+func (sock *InheritedSocket) matches(address config.Connection, ip net.IP) bool {
+	if address.Network == "systemd" {
+		return sock.Name == address.Name
+	}
+	var bound net.Addr
+	if sock.Listener != nil {
+		bound = sock.Listener.Addr()
+	} else {
+		bound = sock.Packets.LocalAddr()
+	}
+	switch addr := bound.(type) {
+	case *net.TCPAddr:
+		return address.Network == "" && sameEndpoint(addr.IP, addr.Port, ip, address.Port)
+	case *net.UDPAddr:
+		return address.Network == "udp" && sameEndpoint(addr.IP, addr.Port, ip, address.Port)
+	case *net.UnixAddr:
+		return address.Network == "unix" && addr.Name == address.Path
+	default:
+		return false
+	}
+}
+
+// sameEndpoint determines if a bound socket is listening on an address, where an unspecified address matches another of the same family and a missing address matches any of them
+func sameEndpoint(boundIP net.IP, boundPort int, ip net.IP, port int) bool {
+	if boundPort != port {
+		return false
+	}
+	if boundIP.IsUnspecified() || len(boundIP) == 0 {
+		if len(ip) == 0 || len(boundIP) == 0 {
+			return len(ip) == 0 || ip.IsUnspecified()
+		}
+		return ip.IsUnspecified() && (ip.To4() == nil) == (boundIP.To4() == nil)
+	}
+	return boundIP.Equal(ip)
+}
+
+// CloseUnused closes the sockets that no listen address claimed
+func (inh *Inherited) CloseUnused(log *logging.Logger) {
+	inh.Mutex.Lock()
+	defer inh.Mutex.Unlock()
+	for _, sock := range inh.Sockets {
+		if !sock.Used {
+			log.Warningf("Closing inherited socket %s because no service listens on it", sock)
+			sock.Close()
+			sock.Used = true
+		}
+	}
+}
+
+// Close every socket that has not been claimed
+func (inh *Inherited) Close() {
+	for _, sock := range inh.Sockets {
+		if !sock.Used {
+			sock.Close()
+		}
+	}
+}
+
+// NotifyReady tells the instance that started this one that it can stop listening
+func (inh *Inherited) NotifyReady() {
+	if inh.Ready == nil {
+		return
+	}
+	inh.Ready.Write([]byte{1})
+	inh.Ready.Close()
+	inh.Ready = nil
+}
+
+// Close the socket
+func (sock *InheritedSocket) Close() {
+	if sock.Listener != nil {
+		sock.Listener.Close()
+	} else {
+		sock.Packets.Close()
+	}
+}
+
+func (sock InheritedSocket) String() string {
+	if sock.Listener != nil {
+		return fmt.Sprintf("%s (%s)", sock.Name, sock.Listener.Addr())
+	}
+	return fmt.Sprintf("%s (udp:%s)", sock.Name, sock.Packets.LocalAddr())
+}
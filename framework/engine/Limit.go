@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"net"
+	"sync"
+)
+
+// Limit counts connections against a maximum in total and a maximum per client IP
+type Limit struct {
+	Total int
+	PerIP map[string]int
+	Mutex sync.Mutex
+}
+
+// CreateLimit creates a new Limit
+func CreateLimit() *Limit {
+	return &Limit{
+		Total: 0,
+		PerIP: map[string]int{},
+	}
+}
+
+// clientIP gets the IP part of a client address so that connections from different ports count together
+func clientIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// Acquire counts a connection unless it would go over either maximum, where zero means no limit
+func (l *Limit) Acquire(ip string, max int, maxPerIP int) bool {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	if max > 0 && l.Total >= max {
+		return false
+	}
+	if maxPerIP > 0 && l.PerIP[ip] >= maxPerIP {
+		return false
+	}
+	l.Total++
+	l.PerIP[ip]++
+	return true
+}
+
+// Release stops counting a connection that was acquired
+func (l *Limit) Release(ip string) {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	l.Total--
+	l.PerIP[ip]--
+	if l.PerIP[ip] <= 0 {
+		delete(l.PerIP, ip)
+	}
+}
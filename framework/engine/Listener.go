@@ -1,29 +1,109 @@
 package engine
 
 import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/logging"
 )
 
+// proxyHeaderTimeout is how long a proxy has to send the PROXY protocol header
+const proxyHeaderTimeout = 5 * time.Second
+
+// tlsRecordHeader is how every TLS handshake starts: a handshake record and the major version of TLS
+var tlsRecordHeader = []byte{0x16, 0x03}
+
 // Listener handles listening for incomming connections
 type Listener struct {
-	Socket    net.Listener
+	Address   config.Connection
+	Network   string
+	IPv6Only  bool
+	Sockets   []net.Listener
+	Packets   []*net.UDPConn
+	Flows     map[string]*Flow
+	Pending   map[net.Conn]bool
 	Service   *Service
 	Engine    *Engine
 	WaitGroup sync.WaitGroup
-	Cleanup   bool
+	Cleanup   int32
+	Paused    int32
+	Log       *logging.Logger
+	Mutex     sync.Mutex
 }
 
-// CreateListener creates a new Listener
-func CreateListener(address config.Connection, service *Service, engine *Engine) (*Listener, error) {
+// CreateListener creates a new Listener with a socket for every address that its host resolves to, using the socket options from the configuration of its Service
+func CreateListener(address config.Connection, cfg config.Service, service *Service, engine *Engine) (*Listener, error) {
 	l := &Listener{
-		Service: service,
-		Engine:  engine,
-		Cleanup: false,
+		Address:  address,
+		Network:  cfg.Network,
+		IPv6Only: cfg.IPv6Only,
+		Service:  service,
+		Engine:   engine,
+		Sockets:  []net.Listener{},
+		Packets:  []*net.UDPConn{},
+		Flows:    map[string]*Flow{},
+		Pending:  map[net.Conn]bool{},
+		Cleanup:  0,
+		Log:      service.Log.With("listener", address.String()),
+	}
+	if address.Network == "systemd" {
+		// systemd passes every socket from a ListenStream or ListenDatagram line with the same name
+		for sock := engine.Inherited.Take(address, nil); sock != nil; sock = engine.Inherited.Take(address, nil) {
+			if err := l.adopt(sock); err != nil {
+				l.close()
+				return nil, err
+			}
+		}
+		if len(l.Sockets)+len(l.Packets) == 0 {
+			return nil, ErrorNotInherited(address.Name)
+		}
+		return l, nil
+	}
+	if address.Network == "unix" {
+		if sock := engine.Inherited.Take(address, nil); sock != nil {
+			if err := l.adopt(sock); err != nil {
+				return nil, err
+			}
+			return l, nil
+		}
+		listener, err := framework.Listen(address)
+		if err != nil {
+			return nil, ErrorListenStart(address, err)
+		}
+		l.Sockets = append(l.Sockets, listener)
+		return l, nil
+	}
+	ips, err := listenIPs(address, cfg.IPv6Only)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if sock := engine.Inherited.Take(address, ip); sock != nil {
+			err = l.adopt(sock)
+		} else {
+			err = l.bind(ip)
+		}
+		if err != nil {
+			l.close()
+			return nil, err
+		}
 	}
-	var ip net.IP
+	return l, nil
+}
+
+// listenIPs finds the addresses that a listen address binds to
+//
+// A nil address binds a single dual-stack socket to every address, unless ipv6Only splits it into one IPv4 and one IPv6 socket.
+func listenIPs(address config.Connection, ipv6Only bool) ([]net.IP, error) {
 	if len(address.Host) > 0 {
 		ips, err := net.LookupIP(address.Host)
 		if err != nil {
@@ -32,47 +112,409 @@ func CreateListener(address config.Connection, service *Service, engine *Engine)
 		if len(ips) == 0 {
 			return nil, ErrorNoHostRecords(address.Host)
 		}
-		ip = ips[0]
-	} else {
-		ip = address.IP
+		return ips, nil
+	}
+	if address.IP != nil {
+		return []net.IP{address.IP}, nil
+	}
+	if ipv6Only {
+		return []net.IP{net.IPv4zero, net.IPv6unspecified}, nil
+	}
+	return []net.IP{nil}, nil
+}
+
+// socketKey identifies the sockets that a listen address needs on a network, so that a new configuration can reuse the sockets of a Listener that has the same key
+func socketKey(address config.Connection, network string, ipv6Only bool) string {
+	if len(address.Network) > 0 {
+		// Unix domain and inherited sockets do not depend on the options of the service
+		return address.Network + " " + address.String()
+	}
+	return fmt.Sprintf("%s %s %t", network, address, ipv6Only)
+}
+
+// key identifies the sockets of the Listener
+func (l *Listener) key() string {
+	return socketKey(l.Address, l.Network, l.IPv6Only)
+}
+
+// bind opens a socket on one of the addresses of the Listener
+func (l *Listener) bind(ip net.IP) error {
+	// Only an IPv6 socket on "tcp" or "udp" accepts IPv4 clients as well
+	network := l.Network
+	if ip.To4() != nil {
+		network += "4"
+	} else if ip != nil && l.IPv6Only {
+		network += "6"
+	}
+	if l.Network == "udp" {
+		packets, err := net.ListenUDP(network, &net.UDPAddr{
+			IP:   ip,
+			Port: l.Address.Port,
+		})
+		if err != nil {
+			return ErrorListenStart(l.Address, err)
+		}
+		l.Packets = append(l.Packets, packets)
+		return nil
 	}
-	listener, err := net.ListenTCP("tcp", &net.TCPAddr{
+	listener, err := net.ListenTCP(network, &net.TCPAddr{
 		IP:   ip,
-		Port: address.Port,
+		Port: l.Address.Port,
 	})
 	if err != nil {
-		return nil, ErrorListenStart(address, err)
+		return ErrorListenStart(l.Address, err)
+	}
+	l.Sockets = append(l.Sockets, listener)
+	return nil
+}
+
+// adopt uses an inherited socket instead of opening a new one
+func (l *Listener) adopt(sock *InheritedSocket) error {
+	if (l.Network == "udp") != (sock.Packets != nil) {
+		sock.Close()
+		return ErrorInheritedType(sock, l.Network)
+	}
+	if sock.Packets != nil {
+		l.Packets = append(l.Packets, sock.Packets)
+	} else {
+		l.Sockets = append(l.Sockets, sock.Listener)
+	}
+	l.Log.Debugf("Using inherited socket %s", sock)
+	return nil
+}
+
+// Files duplicates the listening sockets so that they can be passed to another process
+func (l *Listener) Files() ([]*os.File, error) {
+	socks := []interface{}{}
+	for _, s := range l.Sockets {
+		socks = append(socks, s)
+	}
+	for _, p := range l.Packets {
+		socks = append(socks, p)
+	}
+	files := []*os.File{}
+	for _, sock := range socks {
+		f, ok := sock.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, ErrorNotFile(l.Address)
+		}
+		file, err := f.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// closeFiles closes every file in a list
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// KeepSocketFile stops the listener from removing its unix domain socket when it is closed, since another process is using it
+func (l *Listener) KeepSocketFile() {
+	for _, s := range l.Sockets {
+		if u, ok := s.(*net.UnixListener); ok {
+			u.SetUnlinkOnClose(false)
+		}
 	}
-	l.Socket = listener
-	return l, nil
 }
 
 // Start the listener
 func (l *Listener) Start() {
-	l.WaitGroup.Add(1)
-	go func() {
-		defer l.WaitGroup.Done()
-		for !l.Cleanup {
-			conn, err := l.Socket.Accept()
-			if err != nil || l.Cleanup {
-				if err != nil && !l.Cleanup {
-					l.Engine.NormalError(err)
-				}
-				if l.Cleanup {
-					return
-				}
-			} else {
-				l.Service.AddRemote(conn)
+	for _, p := range l.Packets {
+		l.WaitGroup.Add(1)
+		go l.receive(p)
+	}
+	for _, s := range l.Sockets {
+		l.WaitGroup.Add(1)
+		go l.accept(s)
+	}
+}
+
+// accept hands the connections from one of the sockets to the Service until the listener is stopped
+func (l *Listener) accept(socket net.Listener) {
+	defer l.WaitGroup.Done()
+	for !l.stopping() {
+		conn, err := socket.Accept()
+		if err != nil {
+			if l.stopping() {
+				return
 			}
+			l.Log.Errorf("Unable to accept connection: %s", err)
+		} else if l.IsPaused() {
+			l.Log.Debugf("Refusing connection from %s while paused", conn.RemoteAddr())
+			conn.Close()
+		} else if l.Service.AcceptsProxyProtocol() {
+			if l.expectHeader(conn) {
+				// Reading the header could take a while, so it cannot hold up the next client
+				l.WaitGroup.Add(1)
+				go l.unwrap(conn)
+			}
+		} else {
+			l.admit(conn)
 		}
-	}()
+	}
+}
+
+// expectHeader checks a connection from a load balancer before its PROXY protocol header is read, which takes a slot from the total of the Service Limit until the client is known
+func (l *Listener) expectHeader(conn net.Conn) bool {
+	if !l.Service.TrustsProxy(conn.RemoteAddr()) {
+		l.Log.Warningf("%s", framework.CountError(ErrorUntrustedProxy(conn.RemoteAddr())))
+		conn.Close()
+		return false
+	}
+	if !l.Service.Reserve(conn.RemoteAddr(), l.Log) {
+		conn.Close()
+		return false
+	}
+	if !l.addPending(conn) {
+		conn.Close()
+		l.Service.Limit.Release(clientIP(conn.RemoteAddr()))
+		return false
+	}
+	return true
+}
+
+// unwrap reads the PROXY protocol header from a connection before admitting it as the client that the header describes
+func (l *Listener) unwrap(conn net.Conn) {
+	defer l.WaitGroup.Done()
+	conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	src, dst, err := framework.ReadProxyHeader(conn)
+	conn.SetReadDeadline(time.Time{})
+	l.removePending(conn)
+	// The client that the header describes is admitted in place of the load balancer
+	l.Service.Limit.Release(clientIP(conn.RemoteAddr()))
+	if l.stopping() {
+		conn.Close()
+		return
+	}
+	if err != nil {
+		l.Log.Warningf("%s", framework.CountError(ErrorProxyHeader(conn.RemoteAddr(), err)))
+		conn.Close()
+		return
+	}
+	if src != nil {
+		conn = &ProxiedConn{
+			Conn:        conn,
+			Source:      src,
+			Destination: dst,
+		}
+	}
+	l.admit(conn)
+}
+
+// admit hands a connection to the Service if the Service allows the client
+func (l *Listener) admit(conn net.Conn) {
+	if !l.Service.Permits(conn.RemoteAddr()) {
+		l.Log.Debugf("%s", framework.CountError(ErrorNotAllowed(conn.RemoteAddr())))
+		conn.Close()
+		return
+	}
+	metricAccepted.Inc(l.Address.String())
+	cfg, optional, timeout := l.Service.TLSConfig()
+	if cfg != nil && optional {
+		// Clients waiting to be detected count against the limits so that they cannot pile up
+		if !l.Service.Admit(conn.RemoteAddr(), l.Log) {
+			conn.Close()
+			return
+		}
+		if !l.addPending(conn) {
+			conn.Close()
+			l.Service.Limit.Release(clientIP(conn.RemoteAddr()))
+			return
+		}
+		// Waiting for the first bytes could take a while, so it cannot hold up the next client
+		l.WaitGroup.Add(1)
+		go l.detect(conn, cfg, timeout)
+		return
+	}
+	if cfg != nil {
+		conn = Terminate(conn, cfg)
+	}
+	l.Service.AddRemote(conn, l.Log)
+}
+
+// detect peeks at the first bytes from a client to terminate TLS only if the client starts with a TLS handshake
+//
+// Clients that send nothing in time are treated as plaintext, since they may be waiting for the server to speak first.
+func (l *Listener) detect(conn net.Conn, cfg *tls.Config, timeout time.Duration) {
+	defer l.WaitGroup.Done()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	peeked := make([]byte, len(tlsRecordHeader))
+	// The rest of the header is only waited for if the first byte could start a handshake, since some plaintext clients send a single byte and wait for a reply
+	n, _ := io.ReadFull(conn, peeked[:1])
+	if n == 1 && peeked[0] == tlsRecordHeader[0] {
+		m, _ := io.ReadFull(conn, peeked[1:])
+		n += m
+	}
+	conn.SetReadDeadline(time.Time{})
+	l.removePending(conn)
+	if l.stopping() {
+		conn.Close()
+		l.Service.Limit.Release(clientIP(conn.RemoteAddr()))
+		return
+	}
+	// Errors are left for the matching to run into again when it reads
+	conn = &PeekedConn{
+		Conn:   conn,
+		Peeked: peeked[:n],
+	}
+	if bytes.Equal(peeked[:n], tlsRecordHeader) {
+		conn = Terminate(conn, cfg)
+		metricDetected.Inc(l.Address.String(), "tls")
+	} else {
+		metricDetected.Inc(l.Address.String(), "plaintext")
+	}
+	l.Service.AddAdmitted(conn, l.Log)
+}
+
+// addPending keeps track of a connection that is waiting on its client before it is admitted, so that stopping the listener can cut the wait short
+//
+// It returns false if the listener is already stopping.
+func (l *Listener) addPending(conn net.Conn) bool {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	if l.stopping() {
+		return false
+	}
+	l.Pending[conn] = true
+	return true
+}
+
+// removePending stops keeping track of a connection once its client is done being waited on
+func (l *Listener) removePending(conn net.Conn) {
+	l.Mutex.Lock()
+	delete(l.Pending, conn)
+	l.Mutex.Unlock()
+}
+
+// receive reads datagrams, forwarding them through the Flow for their client or starting a new Flow
+func (l *Listener) receive(packets *net.UDPConn) {
+	defer l.WaitGroup.Done()
+	buffer := make([]byte, datagramSize)
+	for !l.stopping() {
+		n, addr, err := packets.ReadFromUDP(buffer)
+		if err != nil {
+			if l.stopping() {
+				return
+			}
+			l.Log.Errorf("Unable to receive datagram: %s", err)
+			continue
+		}
+		l.Mutex.Lock()
+		flow := l.Flows[addr.String()]
+		l.Mutex.Unlock()
+		if flow != nil {
+			flow.Forward(buffer[:n])
+		} else if l.IsPaused() {
+			l.Log.Debugf("Dropping datagram from %s while paused", addr)
+		} else {
+			l.open(packets, addr, buffer[:n])
+		}
+	}
+}
+
+// open starts a new Flow for a client if its first datagram matches a protocol, replying to the client from the socket that it sent the datagram to
+func (l *Listener) open(packets *net.UDPConn, addr *net.UDPAddr, datagram []byte) {
+	if !l.Service.Permits(addr) {
+		l.Log.Debugf("%s", framework.CountError(ErrorNotAllowed(addr)))
+		return
+	}
+	metricAccepted.Inc(l.Address.String())
+	proto := l.Service.RouteFlow(addr, datagram, l.Log)
+	if proto == nil {
+		// The next datagram from the client gets another chance to match
+		l.Log.Debugf("No protocol matched datagram from %s", addr)
+		return
+	}
+	flow, err := CreateFlow(addr, packets, proto, l, l.Log)
+	if err != nil {
+		l.Log.Warningf("%s", framework.CountError(err))
+		ip := clientIP(addr)
+		proto.Limit.Release(ip)
+		l.Service.Limit.Release(ip)
+		return
+	}
+	l.Mutex.Lock()
+	l.Flows[addr.String()] = flow
+	l.Mutex.Unlock()
+	flow.Forward(datagram)
+	flow.Start()
+}
+
+// ReleaseFlow removes a closed Flow from the NAT table
+func (l *Listener) ReleaseFlow(f *Flow) {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	if l.Flows[f.Client.String()] == f {
+		delete(l.Flows, f.Client.String())
+	}
+}
+
+// FlowList copies the open Flows so that they can be inspected without holding the lock
+func (l *Listener) FlowList() []*Flow {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	flows := make([]*Flow, 0, len(l.Flows))
+	for _, f := range l.Flows {
+		flows = append(flows, f)
+	}
+	return flows
+}
+
+// Pause the listener so that it refuses new connections without giving up its address
+func (l *Listener) Pause() {
+	atomic.StoreInt32(&l.Paused, 1)
+}
+
+// Resume accepting connections on a paused listener
+func (l *Listener) Resume() {
+	atomic.StoreInt32(&l.Paused, 0)
+}
+
+// IsPaused determines if the listener is refusing new connections
+func (l *Listener) IsPaused() bool {
+	return atomic.LoadInt32(&l.Paused) != 0
+}
+
+// stopping determines if the listener is being stopped, so errors from its closed sockets are expected
+func (l *Listener) stopping() bool {
+	return atomic.LoadInt32(&l.Cleanup) != 0
 }
 
 // Stop the listener (and free resources)
 func (l *Listener) Stop() {
-	l.Cleanup = true
-	if err := l.Socket.Close(); err != nil {
-		l.Engine.NonCriticalError(err)
+	atomic.StoreInt32(&l.Cleanup, 1)
+	l.close()
+	// Clients that are still being waited on would otherwise hold up the listener until they time out
+	l.Mutex.Lock()
+	for conn := range l.Pending {
+		conn.Close()
 	}
+	l.Mutex.Unlock()
 	l.WaitGroup.Wait()
+	// Replies cannot reach the clients once the socket is closed
+	for _, f := range l.FlowList() {
+		f.CloseFor("shutdown")
+	}
+}
+
+// close every socket of the listener
+func (l *Listener) close() {
+	for _, s := range l.Sockets {
+		if err := s.Close(); err != nil {
+			l.Log.Debugf("Unable to close listener: %s", err)
+		}
+	}
+	for _, p := range l.Packets {
+		if err := p.Close(); err != nil {
+			l.Log.Debugf("Unable to close listener: %s", err)
+		}
+	}
 }
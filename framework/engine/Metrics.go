@@ -0,0 +1,15 @@
+package engine
+
+import "github.com/zachdeibert/protomux/metrics"
+
+// matchBuckets are the histogram buckets for how long matching takes, in seconds
+var matchBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+
+var (
+	metricAccepted  = metrics.Default.Counter("protomux_accepted_connections_total", "Connections accepted by each listener", "listener")
+	metricMatches   = metrics.Default.Counter("protomux_match_outcomes_total", "How each protocol candidate finished matching (won, lost or rejected)", "protocol", "remote", "outcome")
+	metricMatchTime = metrics.Default.Histogram("protomux_match_duration_seconds", "Time from accepting a connection until a protocol claimed it", matchBuckets, "protocol", "remote")
+	metricBytes     = metrics.Default.Counter("protomux_bytes_total", "Bytes transferred by connections that a protocol has claimed", "protocol", "remote", "direction")
+	metricErrors    = metrics.Default.Counter("protomux_errors_total", "Engine errors by code", "code")
+	metricDetected  = metrics.Default.Counter("protomux_tls_detected_total", "Connections on services with optional TLS by whether they started with a TLS handshake (tls or plaintext)", "listener", "kind")
+)
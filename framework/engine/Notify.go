@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// notifyMainPID tells systemd that another process has taken over as the main process of the service, if the process was started by systemd
+func notifyMainPID(pid int) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	// Addresses starting with @ are in the abstract namespace, which net already understands
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: addr,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(fmt.Sprintf("MAINPID=%d", pid)))
+	return err
+}
@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"net"
+)
+
+// PeekedConn is a socket that some bytes were already read from, which it gives back before reading any more
+type PeekedConn struct {
+	net.Conn
+	Peeked []byte
+}
+
+// Read the peeked bytes first and then the rest of the socket
+func (c *PeekedConn) Read(b []byte) (int, error) {
+	if len(c.Peeked) > 0 {
+		n := copy(b, c.Peeked)
+		c.Peeked = c.Peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// CloseWrite shuts down the writing side of the socket
+func (c *PeekedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
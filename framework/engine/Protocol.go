@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// Protocol is a ProtocolInstance along with the configuration it came from
+type Protocol struct {
+	Name     string
+	Remote   string
+	Index    int
+	Instance framework.ProtocolInstance
+	// MaxConnections is the most sessions the remote handles at once, or zero for no limit
+	MaxConnections int
+	// MaxConnectionsPerIP is the most sessions the remote handles at once for one client IP, or zero for no limit
+	MaxConnectionsPerIP int
+	Limit               *Limit
+	// ACL decides which clients the Protocol is a candidate for
+	ACL config.ACL
+	// ProxyProtocol is the version of the PROXY protocol header that the backend expects, or empty if it does not expect one
+	ProxyProtocol string
+}
+
+// RemoteName identifies which remote block of the protocol this is
+func (p Protocol) RemoteName() string {
+	return fmt.Sprintf("%s#%d", p.Remote, p.Index+1)
+}
+
+func (p Protocol) String() string {
+	return fmt.Sprintf("%s/%s", p.Name, p.RemoteName())
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"net"
+)
+
+// ProxiedConn is a socket from a proxy that reports the addresses of the client that the proxy is forwarding
+type ProxiedConn struct {
+	net.Conn
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// listenerAddr gets the address of the listener that accepted a socket, even if the socket came through a proxy
+func listenerAddr(conn net.Conn) net.Addr {
+	for {
+		switch c := conn.(type) {
+		case *TerminatedConn:
+			conn = c.Raw
+			break
+		case *PeekedConn:
+			conn = c.Conn
+			break
+		case *ProxiedConn:
+			return c.Conn.LocalAddr()
+		default:
+			return conn.LocalAddr()
+		}
+	}
+}
+
+// RemoteAddr gets the address of the client
+func (c *ProxiedConn) RemoteAddr() net.Addr {
+	return c.Source
+}
+
+// LocalAddr gets the address that the client connected to
+func (c *ProxiedConn) LocalAddr() net.Addr {
+	return c.Destination
+}
+
+// CloseWrite shuts down the writing side of the socket to the proxy
+func (c *ProxiedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
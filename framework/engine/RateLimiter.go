@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TokenBucket holds the connections that one source is still allowed to open
+type TokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// RateLimiter limits how often each source can open connections using a TokenBucket per source
+type RateLimiter struct {
+	Buckets map[string]*TokenBucket
+	Swept   time.Time
+	Mutex   sync.Mutex
+}
+
+// CreateRateLimiter creates a new RateLimiter
+func CreateRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Buckets: map[string]*TokenBucket{},
+		Swept:   time.Now(),
+	}
+}
+
+// subnet gets the subnet that an IP is rate limited with
+func subnet(ip string, prefix int, prefix6 int) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(prefix, 32)).String() + "/" + strconv.Itoa(prefix)
+	}
+	return addr.Mask(net.CIDRMask(prefix6, 128)).String() + "/" + strconv.Itoa(prefix6)
+}
+
+// refill adds the tokens that have been earned since the TokenBucket was last updated
+func (b *TokenBucket) refill(now time.Time, rate int, interval time.Duration) {
+	b.Tokens += now.Sub(b.Updated).Seconds() / interval.Seconds() * float64(rate)
+	if b.Tokens > float64(rate) {
+		b.Tokens = float64(rate)
+	}
+	b.Updated = now
+}
+
+// Allow takes a token from the source, allowing rate connections in each interval with bursts up to rate
+func (r *RateLimiter) Allow(source string, rate int, interval time.Duration) bool {
+	if rate <= 0 || interval <= 0 {
+		return true
+	}
+	now := time.Now()
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+	if now.Sub(r.Swept) > interval {
+		// Sources that have earned back all of their tokens do not need to be remembered
+		for k, b := range r.Buckets {
+			b.refill(now, rate, interval)
+			if b.Tokens >= float64(rate) {
+				delete(r.Buckets, k)
+			}
+		}
+		r.Swept = now
+	}
+	b, ok := r.Buckets[source]
+	if ok {
+		b.refill(now, rate, interval)
+	} else {
+		b = &TokenBucket{
+			Tokens:  float64(rate),
+			Updated: now,
+		}
+		r.Buckets[source] = b
+	}
+	if b.Tokens < 1 {
+		return false
+	}
+	b.Tokens--
+	return true
+}
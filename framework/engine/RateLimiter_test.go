@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	r := CreateRateLimiter()
+	for i := 0; i < 3; i++ {
+		if !r.Allow("192.0.2.10", 3, time.Minute) {
+			t.Fatalf("connection %d was not allowed", i+1)
+		}
+	}
+	if r.Allow("192.0.2.10", 3, time.Minute) {
+		t.Error("connection after the burst was allowed")
+	}
+	if !r.Allow("192.0.2.11", 3, time.Minute) {
+		t.Error("another source shares the bucket")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	r := CreateRateLimiter()
+	for i := 0; i < 100; i++ {
+		if !r.Allow("192.0.2.10", 0, time.Minute) || !r.Allow("192.0.2.10", 1, 0) {
+			t.Fatal("connection was limited without a rate")
+		}
+	}
+	if len(r.Buckets) != 0 {
+		t.Errorf("%d buckets were kept without a rate", len(r.Buckets))
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	r := CreateRateLimiter()
+	r.Allow("192.0.2.10", 2, time.Minute)
+	r.Allow("192.0.2.10", 2, time.Minute)
+	if r.Allow("192.0.2.10", 2, time.Minute) {
+		t.Fatal("connection after the burst was allowed")
+	}
+	// Half of the interval earns back one of the two tokens
+	r.Buckets["192.0.2.10"].Updated = time.Now().Add(-30 * time.Second)
+	if !r.Allow("192.0.2.10", 2, time.Minute) {
+		t.Error("refilled token was not allowed")
+	}
+	if r.Allow("192.0.2.10", 2, time.Minute) {
+		t.Error("more tokens were refilled than were earned")
+	}
+	// Tokens never build up past the burst
+	r.Buckets["192.0.2.10"].Updated = time.Now().Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		if !r.Allow("192.0.2.10", 2, time.Minute) {
+			t.Fatalf("connection %d after refilling was not allowed", i+1)
+		}
+	}
+	if r.Allow("192.0.2.10", 2, time.Minute) {
+		t.Error("bucket refilled past the burst")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	r := CreateRateLimiter()
+	r.Allow("192.0.2.10", 2, time.Minute)
+	r.Allow("192.0.2.11", 2, time.Minute)
+	r.Allow("192.0.2.11", 2, time.Minute)
+	r.Buckets["192.0.2.10"].Updated = time.Now().Add(-time.Minute)
+	r.Swept = time.Now().Add(-2 * time.Minute)
+	r.Allow("192.0.2.12", 2, time.Minute)
+	if _, ok := r.Buckets["192.0.2.10"]; ok {
+		t.Error("full bucket was not forgotten")
+	}
+	if _, ok := r.Buckets["192.0.2.11"]; !ok {
+		t.Error("bucket that is still refilling was forgotten")
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.10", "192.0.2.0/24"},
+		{"::ffff:192.0.2.10", "192.0.2.0/24"},
+		{"2001:db8:1:2:3::1", "2001:db8:1:2::/64"},
+		{"not an ip", "not an ip"},
+	}
+	for _, test := range tests {
+		if got := subnet(test.ip, 24, 64); got != test.want {
+			t.Errorf("subnet(%q) = %q, want %q", test.ip, got, test.want)
+		}
+	}
+}
@@ -3,109 +3,237 @@ package engine
 import (
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/zachdeibert/protomux/config"
 	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/logging"
 )
 
 const bufferSize = 4096
 
+// goodbyeTimeout is how long a client has to accept the goodbye message before it is disconnected anyway
+const goodbyeTimeout = time.Second
+
+// failedMatchReasons are the reasons for closing a connection that count towards banning its source
+var failedMatchReasons = map[string]bool{
+	"unmatched":                     true,
+	"match timeout":                 true,
+	"match too slow":                true,
+	"buffer limit":                  true,
+	"client closed before matching": true,
+	"tls handshake":                 true,
+}
+
 // RemoteConnection represents one remote connection that can be connected to multiple Connection objects if multiple protocols are being evaluated
 type RemoteConnection struct {
+	ID          uint64
 	Socket      net.Conn
+	Config      config.Service
 	Connections []*Connection
+	Exclusive   *Connection
 	Service     *Service
 	Engine      *Engine
 	Mutex       sync.Mutex
 	Cond        *sync.Cond
 	WaitGroup   sync.WaitGroup
+	Buffer      []byte
+	ReadError   error
+	Reading     bool
 	Closed      bool
+	Done        chan struct{}
+	BytesRead   int64
+	BytesWrote  int64
+	Accepted    time.Time
+	Reason      string
+	MatchTimer  *time.Timer
+	RateTimer   *time.Timer
+	Log         *logging.Logger
 }
 
 // CreateRemoteConnection creates a new RemoteConnection
-func CreateRemoteConnection(conn net.Conn, protocols []framework.ProtocolInstance, service *Service, engine *Engine) *RemoteConnection {
+func CreateRemoteConnection(conn net.Conn, cfg config.Service, protocols []*Protocol, service *Service, engine *Engine, log *logging.Logger) *RemoteConnection {
+	// Protocols that do not allow the client are never candidates for it
+	ip := net.ParseIP(clientIP(conn.RemoteAddr()))
+	allowed := []*Protocol{}
+	for _, proto := range protocols {
+		if proto.ACL.Check(ip) {
+			allowed = append(allowed, proto)
+		}
+	}
+	protocols = allowed
+	id := atomic.AddUint64(&engine.NextID, 1)
 	rc := &RemoteConnection{
+		ID:          id,
 		Socket:      conn,
+		Config:      cfg,
 		Connections: make([]*Connection, len(protocols)),
+		Exclusive:   nil,
 		Service:     service,
 		Engine:      engine,
+		Buffer:      []byte{},
+		ReadError:   nil,
+		Reading:     false,
 		Closed:      false,
+		Done:        make(chan struct{}),
+		BytesRead:   0,
+		BytesWrote:  0,
+		Accepted:    time.Now(),
+		Reason:      "",
+		Log:         log.With("id", id).With("client", conn.RemoteAddr().String()),
 	}
 	rc.Cond = sync.NewCond(&rc.Mutex)
+	rc.Mutex.Lock()
+	if timeout := cfg.MatchTimeout; timeout > 0 {
+		rc.MatchTimer = time.AfterFunc(timeout, func() {
+			rc.Mutex.Lock()
+			done := rc.Exclusive != nil || rc.Closed
+			rc.Mutex.Unlock()
+			if !done {
+				rc.Log.Warningf("%s", framework.CountError(ErrorMatchTimeout(conn.RemoteAddr(), timeout)))
+				rc.CloseFor("match timeout")
+			}
+		})
+	}
+	if cfg.MatchMinBytes > 0 && cfg.MatchInterval > 0 {
+		rc.RateTimer = time.AfterFunc(cfg.MatchInterval, func() {
+			rc.checkRate(0)
+		})
+	}
+	candidates := make([]string, len(protocols))
 	for i, proto := range protocols {
 		rc.Connections[i] = CreateConnection(rc, proto, engine)
+		candidates[i] = proto.String()
+	}
+	rc.Log.With("candidates", candidates).Debugf("Accepted connection")
+	if len(rc.Connections) == 0 {
+		rc.setReason("no protocols")
+		go rc.Close()
 	}
+	rc.Mutex.Unlock()
 	rc.WaitGroup.Add(1)
-	go func() {
-		defer rc.WaitGroup.Done()
-		rc.Mutex.Lock()
-		defer rc.Mutex.Unlock()
-		buffer := make([]byte, bufferSize)
-		for !rc.Closed && len(rc.Connections) > 1 {
-			ready := true
-			for _, c := range rc.Connections {
-				if len(c.ReadBuffer) > 0 {
-					ready = false
-					break
-				}
-			}
-			if ready {
-				n, err := rc.Socket.Read(buffer)
-				if err != nil {
-					engine.NormalError(err)
-					go rc.Close()
-					return
-				}
-				for _, c := range rc.Connections {
-					c.ReadBuffer = buffer[:n]
-				}
-				rc.Cond.Broadcast()
-			} else {
-				rc.Cond.Wait()
+	go rc.record()
+	return rc
+}
+
+// record reads from the socket into the shared buffer until a Connection becomes exclusive
+func (rc *RemoteConnection) record() {
+	defer rc.WaitGroup.Done()
+	if t, ok := rc.Socket.(*TerminatedConn); ok && !rc.handshake(t) {
+		return
+	}
+	rc.Mutex.Lock()
+	defer rc.Mutex.Unlock()
+	// Protocols that are satisfied without any data start before the client sends anything, since some clients wait for the server to speak first
+	rc.match(false)
+	buffer := make([]byte, bufferSize)
+	idle := false
+	for !rc.Closed && rc.Exclusive == nil && rc.ReadError == nil {
+		if len(rc.Buffer) >= rc.Config.MatchBufferLimit {
+			if c := rc.lastCandidate(); c != nil {
+				// There is nothing left to decide between, so the last protocol reads the rest of the stream itself
+				rc.MarkExclusive(c)
+				return
 			}
+			rc.Log.Warningf("%s", framework.CountError(ErrorBufferLimit(rc.Socket.RemoteAddr(), rc.Config.MatchBufferLimit)))
+			rc.setReason("buffer limit")
+			go rc.Close()
+			return
 		}
-	}()
-	rc.WaitGroup.Add(1)
-	go func() {
-		defer rc.WaitGroup.Done()
+		var deadline time.Time
+		if timeout := rc.idleTimeout(); timeout > 0 && !idle {
+			deadline = time.Now().Add(timeout)
+		}
+		// This is done under the Mutex so that it cannot replace a deadline set by a Connection that becomes exclusive
+		rc.Socket.SetReadDeadline(deadline)
+		rc.Reading = true
+		rc.Mutex.Unlock()
+		n, err := rc.Socket.Read(buffer)
+		atomic.AddInt64(&rc.BytesRead, int64(n))
 		rc.Mutex.Lock()
-		defer rc.Mutex.Unlock()
-		for !rc.Closed && len(rc.Connections) > 1 {
-			n := 0
-			for i, c := range rc.Connections {
-				if i == 0 {
-					n = len(c.WriteBuffer)
-				} else {
-					if len(c.WriteBuffer) < n {
-						n = len(c.WriteBuffer)
-					}
-					for i, b := range c.WriteBuffer[:n] {
-						if rc.Connections[0].WriteBuffer[i] != b {
-							n = i
-							break
-						}
-					}
-				}
-				if n == 0 {
-					break
-				}
-			}
-			if n == 0 {
-				rc.Cond.Wait()
-			} else {
-				n, err := rc.Socket.Write(rc.Connections[0].WriteBuffer[:n])
-				if err != nil {
-					engine.NormalError(err)
-					go rc.Close()
-					return
-				}
-				for _, c := range rc.Connections {
-					c.WriteBuffer = c.WriteBuffer[n:]
-				}
-				rc.Cond.Broadcast()
+		rc.Reading = false
+		rc.Buffer = append(rc.Buffer, buffer[:n]...)
+		idle = false
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			// Otherwise the deadline is either the idle timeout or one set by a Connection that is now exclusive
+			rc.ReadError = err
+		} else if n == 0 && !deadline.IsZero() {
+			idle = true
+		}
+		rc.match(idle)
+		rc.Cond.Broadcast()
+	}
+}
+
+// lastCandidate gets the only Connection that is left if its protocol is already handling the stream, or nil if there is still a choice to make
+//
+// The caller must hold the Mutex.
+func (rc *RemoteConnection) lastCandidate() *Connection {
+	if len(rc.Connections) != 1 || rc.Connections[0].Matcher != nil {
+		return nil
+	}
+	return rc.Connections[0]
+}
+
+// handshake finishes the TLS handshake before anything is recorded, so that the protocols only ever see the decrypted stream
+func (rc *RemoteConnection) handshake(t *TerminatedConn) bool {
+	if err := t.Handshake(); err != nil {
+		rc.Mutex.Lock()
+		closed := rc.Closed
+		rc.Mutex.Unlock()
+		if !closed {
+			rc.Log.Warningf("%s", framework.CountError(ErrorTLSHandshake(rc.Socket.RemoteAddr(), err)))
+			// Close waits for this goroutine
+			go rc.CloseFor("tls handshake")
+		}
+		return false
+	}
+	rc.Log.With("serverName", t.ConnectionState().ServerName).Debugf("Finished TLS handshake")
+	return true
+}
+
+// idleTimeout gets how long the client can be quiet before the IdleMatchers judge the recorded prefix, or zero if none of them can
+//
+// The caller must hold the Mutex.
+func (rc *RemoteConnection) idleTimeout() time.Duration {
+	if len(rc.Buffer) == 0 {
+		return 0
+	}
+	var timeout time.Duration
+	for _, c := range rc.Connections {
+		if m, ok := c.Matcher.(framework.IdleMatcher); ok {
+			if t := m.IdleTimeout(); timeout == 0 || t < timeout {
+				timeout = t
 			}
 		}
-	}()
-	return rc
+	}
+	return timeout
+}
+
+// match runs the Matchers that are still waiting for data against the recorded prefix, letting the IdleMatchers decide if the client has gone quiet
+func (rc *RemoteConnection) match(idle bool) {
+	for _, c := range append([]*Connection{}, rc.Connections...) {
+		if c.Matcher == nil {
+			continue
+		}
+		state := c.Matcher.Match(rc.Buffer)
+		if m, ok := c.Matcher.(framework.IdleMatcher); ok && idle && state == framework.ProtocolNeedsMoreData {
+			state = m.MatchIdle(rc.Buffer)
+		}
+		if state == framework.ProtocolNeedsMoreData && rc.ReadError != nil {
+			state = framework.ProtocolNotMatched
+		}
+		switch state {
+		case framework.ProtocolMatched:
+			c.Start()
+			break
+		case framework.ProtocolNotMatched:
+			c.Closed = true
+			rc.removeConnection(c)
+			break
+		}
+	}
 }
 
 // ReleaseConnection marks a Connection as no longer being a valid part of this RemoteConnection
@@ -116,6 +244,19 @@ func (rc *RemoteConnection) ReleaseConnection(c *Connection, wg *sync.WaitGroup)
 		defer rc.WaitGroup.Done()
 		wg.Wait()
 	}()
+	rc.removeConnection(c)
+	rc.Mutex.Unlock()
+}
+
+// removeConnection removes a Connection from the candidates, closing the RemoteConnection once none are left
+func (rc *RemoteConnection) removeConnection(c *Connection) {
+	outcome := "rejected"
+	if rc.Exclusive == c {
+		outcome = "won"
+	} else if rc.Exclusive != nil {
+		outcome = "lost"
+	}
+	metricMatches.Inc(c.Protocol.Name, c.Protocol.RemoteName(), outcome)
 	n := 0
 	for _, x := range rc.Connections {
 		if x != c {
@@ -126,25 +267,191 @@ func (rc *RemoteConnection) ReleaseConnection(c *Connection, wg *sync.WaitGroup)
 	rc.Connections = rc.Connections[:n]
 	rc.Cond.Broadcast()
 	if len(rc.Connections) == 0 {
-		rc.Mutex.Unlock()
-		rc.Close()
-	} else {
-		rc.Mutex.Unlock()
+		if rc.Exclusive != nil {
+			rc.setReason("completed")
+		} else if rc.ReadError != nil {
+			rc.setReason("client closed before matching")
+		} else {
+			rc.setReason("unmatched")
+		}
+		// The caller may be one of the goroutines that Close waits on
+		go rc.Close()
 	}
 }
 
+// MarkExclusive notes that a Connection has claimed this RemoteConnection, so the matching limits no longer apply
+func (rc *RemoteConnection) MarkExclusive(c *Connection) {
+	rc.Exclusive = c
+	c.Log.Infof("Protocol matched")
+	metricMatchTime.Observe(time.Since(rc.Accepted).Seconds(), c.Protocol.Name, c.Protocol.RemoteName())
+	// Whatever the winner already replayed counts as transferred from now on
+	c.BytesIn.Add(float64(c.Offset))
+	if rc.MatchTimer != nil {
+		rc.MatchTimer.Stop()
+	}
+	if rc.RateTimer != nil {
+		rc.RateTimer.Stop()
+	}
+	rc.Cond.Broadcast()
+}
+
+func (rc *RemoteConnection) checkRate(last int64) {
+	rc.Mutex.Lock()
+	done := rc.Exclusive != nil || rc.Closed
+	rc.Mutex.Unlock()
+	if done {
+		return
+	}
+	read := atomic.LoadInt64(&rc.BytesRead)
+	if read-last < int64(rc.Config.MatchMinBytes) {
+		rc.Log.Warningf("%s", framework.CountError(ErrorMatchTooSlow(rc.Socket.RemoteAddr(), read-last, rc.Config.MatchInterval)))
+		rc.CloseFor("match too slow")
+		return
+	}
+	rc.Mutex.Lock()
+	if rc.Exclusive == nil && !rc.Closed {
+		rc.RateTimer = time.AfterFunc(rc.Config.MatchInterval, func() {
+			rc.checkRate(read)
+		})
+	}
+	rc.Mutex.Unlock()
+}
+
+// Drain closes the RemoteConnection unless a protocol has claimed it and cannot say goodbye to the client
+func (rc *RemoteConnection) Drain(reason string) {
+	rc.Mutex.Lock()
+	var goodbye func(string) error
+	if rc.Exclusive != nil {
+		if goodbye = rc.Exclusive.Goodbye; goodbye == nil {
+			rc.Mutex.Unlock()
+			return
+		}
+	}
+	rc.Mutex.Unlock()
+	rc.sayGoodbye(goodbye, reason)
+	rc.CloseFor("shutdown")
+}
+
+// Stop tells a client whose session outlasted the drain why it is being cut off, then closes the RemoteConnection
+func (rc *RemoteConnection) Stop(reason string) {
+	rc.Mutex.Lock()
+	var farewell func(string) error
+	if rc.Exclusive != nil {
+		farewell = rc.Exclusive.Farewell
+	}
+	rc.Mutex.Unlock()
+	rc.sayGoodbye(farewell, reason)
+	rc.CloseFor("shutdown")
+}
+
+// sayGoodbye tells the client why it is being disconnected if the protocol knows how to
+func (rc *RemoteConnection) sayGoodbye(goodbye func(string) error, reason string) {
+	if goodbye == nil {
+		return
+	}
+	// The client may not be reading, so it is not allowed to hold up the shutdown
+	rc.Socket.SetWriteDeadline(time.Now().Add(goodbyeTimeout))
+	if err := goodbye(reason); err != nil {
+		rc.Log.Debugf("Unable to say goodbye: %s", err)
+	}
+}
+
+// setReason records why the RemoteConnection is being closed, unless a reason was already given
+func (rc *RemoteConnection) setReason(reason string) {
+	if rc.Reason == "" {
+		rc.Reason = reason
+	}
+}
+
+// CloseFor closes the RemoteConnection and records why in the access log
+func (rc *RemoteConnection) CloseFor(reason string) {
+	rc.Mutex.Lock()
+	rc.setReason(reason)
+	rc.Mutex.Unlock()
+	rc.Close()
+}
+
 // Close the RemoteConnection
 func (rc *RemoteConnection) Close() {
-	if err := rc.Socket.Close(); err != nil {
-		rc.Engine.NonCriticalError(err)
-	}
 	rc.Mutex.Lock()
+	if rc.Closed {
+		rc.Mutex.Unlock()
+		// Whoever closed it first is still tearing it down
+		<-rc.Done
+		return
+	}
 	rc.Closed = true
+	// Matchers that are still waiting for data have no goroutine that would release them
+	for _, c := range append([]*Connection{}, rc.Connections...) {
+		if c.Matcher != nil {
+			c.Closed = true
+			rc.removeConnection(c)
+		}
+	}
+	if rc.MatchTimer != nil {
+		rc.MatchTimer.Stop()
+	}
+	if rc.RateTimer != nil {
+		rc.RateTimer.Stop()
+	}
 	rc.Cond.Broadcast()
+	rc.Mutex.Unlock()
+	if err := rc.Socket.Close(); err != nil {
+		rc.Log.Debugf("Unable to close socket: %s", err)
+	}
+	rc.Mutex.Lock()
 	for len(rc.Connections) > 0 {
 		rc.Cond.Wait()
 	}
 	rc.Mutex.Unlock()
 	rc.WaitGroup.Wait()
+	if rc.Exclusive != nil && rc.Exclusive.Slot {
+		rc.Exclusive.Protocol.Limit.Release(clientIP(rc.Socket.RemoteAddr()))
+	}
+	rc.access()
+	if rc.Exclusive == nil && failedMatchReasons[rc.Reason] {
+		rc.fail()
+	}
 	rc.Service.ReleaseRemote(rc)
+	close(rc.Done)
+}
+
+// fail counts the failed match against the client, banning it if it has failed too often
+func (rc *RemoteConnection) fail() {
+	ban, err := rc.Engine.Bans.Fail(clientIP(rc.Socket.RemoteAddr()), rc.Config.BanAfter, rc.Config.BanWindow, rc.Config.BanTime)
+	if err != nil {
+		rc.Log.Warningf("%s", framework.CountError(err))
+	}
+	if ban != nil {
+		rc.Log.Warningf("Banned %s: %s", ban.Network, ban.Reason)
+	}
+}
+
+// access writes the access log record for the RemoteConnection once it has been closed
+func (rc *RemoteConnection) access() {
+	log := rc.Engine.Access.
+		With("id", rc.ID).
+		With("accepted", rc.Accepted.UTC().Format(time.RFC3339Nano)).
+		With("client", rc.Socket.RemoteAddr().String()).
+		With("listener", listenerAddr(rc.Socket).String())
+	if rc.Exclusive != nil {
+		log = log.With("protocol", rc.Exclusive.Protocol.String())
+	} else {
+		log = log.With("protocol", "unmatched")
+	}
+	reason := rc.Reason
+	if reason == "" {
+		reason = "closed"
+	}
+	log = log.
+		With("bytesIn", atomic.LoadInt64(&rc.BytesRead)).
+		With("bytesOut", atomic.LoadInt64(&rc.BytesWrote)).
+		With("duration", time.Since(rc.Accepted).String()).
+		With("reason", reason)
+	if rc.Exclusive != nil {
+		for _, f := range rc.Exclusive.Annotations {
+			log = log.With(f.Key, f.Value)
+		}
+	}
+	log.Infof("Connection closed")
 }
@@ -1,32 +1,52 @@
 package engine
 
 import (
+	"crypto/tls"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/zachdeibert/protomux/config"
 	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/logging"
 )
 
 // Service represents a set of listeners that all perform the same task
 type Service struct {
-	Protocols []framework.ProtocolInstance
-	Listeners []*Listener
-	Engine    *Engine
-	Remotes   []*RemoteConnection
-	Mutex     sync.Mutex
+	Config     config.Service
+	Protocols  []*Protocol
+	TLS        *tls.Config
+	Listeners  []*Listener
+	Engine     *Engine
+	Remotes    []*RemoteConnection
+	Limit      *Limit
+	IPRate     *RateLimiter
+	SubnetRate *RateLimiter
+	Log        *logging.Logger
+	Retired    bool
+	Mutex      sync.Mutex
+	Cond       *sync.Cond
 }
 
 // CreateService creates a new Service
-func CreateService(addresses []config.Connection, protocols []framework.ProtocolInstance, engine *Engine) (*Service, error) {
+func CreateService(cfg config.Service, protocols []*Protocol, tlsConfig *tls.Config, engine *Engine) (*Service, error) {
 	srv := &Service{
-		Protocols: protocols,
-		Listeners: make([]*Listener, len(addresses)),
-		Engine:    engine,
-		Remotes:   []*RemoteConnection{},
+		Config:     cfg,
+		Protocols:  protocols,
+		TLS:        tlsConfig,
+		Listeners:  make([]*Listener, len(cfg.ListenAddresses)),
+		Engine:     engine,
+		Remotes:    []*RemoteConnection{},
+		Limit:      CreateLimit(),
+		IPRate:     CreateRateLimiter(),
+		SubnetRate: CreateRateLimiter(),
+		Log:        engine.Log,
+		Retired:    false,
 	}
-	for i, addr := range addresses {
-		l, err := CreateListener(addr, srv, engine)
+	srv.Cond = sync.NewCond(&srv.Mutex)
+	for i, addr := range cfg.ListenAddresses {
+		l, err := CreateListener(addr, cfg, srv, engine)
 		if err != nil {
 			return nil, err
 		}
@@ -37,23 +57,153 @@ func CreateService(addresses []config.Connection, protocols []framework.Protocol
 
 // Start the Service
 func (s *Service) Start() {
-	for _, l := range s.Listeners {
+	for _, l := range s.ListenerList() {
 		l.Start()
 	}
 }
 
-// Stop the Service
-func (s *Service) Stop() {
+// ListenerList copies the Listeners so that they can be used without holding the lock
+func (s *Service) ListenerList() []*Listener {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return append([]*Listener{}, s.Listeners...)
+}
+
+// AddListener starts a Listener that was opened for the Service
+func (s *Service) AddListener(l *Listener) {
+	s.Mutex.Lock()
+	s.Listeners = append(s.Listeners, l)
+	s.Mutex.Unlock()
+	l.Start()
+}
+
+// Name identifies the Service by the addresses it listens on
+func (s *Service) Name() string {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	addrs := make([]string, len(s.Config.ListenAddresses))
+	for i, addr := range s.Config.ListenAddresses {
+		addrs[i] = addr.String()
+	}
+	return strings.Join(addrs, ",")
+}
+
+// Permits determines if the Service accepts connections from a client
+func (s *Service) Permits(addr net.Addr) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.Config.ACL.Check(net.ParseIP(clientIP(addr)))
+}
+
+// AcceptsProxyProtocol determines if connections to the Service start with a PROXY protocol header
+func (s *Service) AcceptsProxyProtocol() bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.Config.AcceptProxyProtocol
+}
+
+// TLSConfig gets the configuration to terminate TLS on new connections with, or nil if they are plaintext, whether clients can choose to send plaintext anyway, and how long to wait for them to start sending
+func (s *Service) TLSConfig() (*tls.Config, bool, time.Duration) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if s.TLS == nil {
+		return nil, false, 0
+	}
+	return s.TLS, s.Config.TLS.Optional, s.Config.TLS.DetectTimeout
+}
+
+// TrustsProxy determines if a proxy is allowed to tell the Service where its connections come from
+func (s *Service) TrustsProxy(addr net.Addr) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	ip := net.ParseIP(clientIP(addr))
+	for _, network := range s.Config.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconfigure the Service for new connections, starting the listeners that were opened for the addresses it was not already listening on
+func (s *Service) Reconfigure(cfg config.Service, protocols []*Protocol, tlsConfig *tls.Config, listeners []*Listener) {
+	s.Mutex.Lock()
+	// Sessions that are still open keep counting against the limits of the remote they matched
+	limits := map[string]*Limit{}
+	for _, proto := range s.Protocols {
+		limits[proto.String()] = proto.Limit
+	}
+	for _, proto := range protocols {
+		if l, ok := limits[proto.String()]; ok {
+			proto.Limit = l
+		}
+	}
+	s.Config = cfg
+	s.Protocols = protocols
+	s.TLS = tlsConfig
+	s.Mutex.Unlock()
+	for _, l := range listeners {
+		s.AddListener(l)
+	}
+}
+
+// StopListeners stops the listeners that are not being kept without closing any connections, returning the ones that were stopped
+func (s *Service) StopListeners(keep map[*Listener]bool) []*Listener {
+	stopped := []*Listener{}
+	s.Mutex.Lock()
+	n := 0
 	for _, l := range s.Listeners {
+		if keep[l] {
+			s.Listeners[n] = l
+			n++
+		} else {
+			stopped = append(stopped, l)
+		}
+	}
+	s.Listeners = s.Listeners[:n]
+	s.Mutex.Unlock()
+	// Stopping waits for the listeners to finish handing off connections, which needs the lock
+	for _, l := range stopped {
 		l.Stop()
 	}
+	return stopped
+}
+
+// Drain stops accepting connections and disconnects the clients that are not in the middle of a session
+func (s *Service) Drain(reason string) {
+	s.StopListeners(nil)
 	var wg sync.WaitGroup
 	s.Mutex.Lock()
 	for _, remote := range s.Remotes {
 		wg.Add(1)
 		go func(remote *RemoteConnection) {
 			defer wg.Done()
-			remote.Close()
+			remote.Drain(reason)
+		}(remote)
+	}
+	s.Mutex.Unlock()
+	wg.Wait()
+}
+
+// Wait for all of the connections to the Service to be closed
+func (s *Service) Wait() {
+	s.Mutex.Lock()
+	for len(s.Remotes) > 0 {
+		s.Cond.Wait()
+	}
+	s.Mutex.Unlock()
+}
+
+// Stop the Service, telling the clients that are still connected why they are being cut off
+func (s *Service) Stop(reason string) {
+	s.StopListeners(nil)
+	var wg sync.WaitGroup
+	s.Mutex.Lock()
+	for _, remote := range s.Remotes {
+		wg.Add(1)
+		go func(remote *RemoteConnection) {
+			defer wg.Done()
+			remote.Stop(reason)
 		}(remote)
 	}
 	s.Mutex.Unlock()
@@ -71,12 +221,96 @@ func (s *Service) ReleaseRemote(r *RemoteConnection) {
 		}
 	}
 	s.Remotes = s.Remotes[:n]
+	s.Cond.Broadcast()
+	if s.Retired && len(s.Remotes) == 0 {
+		// The Engine may be holding its lock while it closes this connection
+		go s.Engine.prune(s)
+	}
 	s.Mutex.Unlock()
+	s.Limit.Release(clientIP(r.Socket.RemoteAddr()))
+}
+
+// accepts checks the bans, rate limits and connection limits for a new client, taking a slot from the Service Limit if it is accepted
+//
+// The caller must hold the Mutex.
+func (s *Service) accepts(addr net.Addr, log *logging.Logger) bool {
+	ip := clientIP(addr)
+	if ban := s.Engine.Bans.Banned(ip); ban != nil {
+		// Banned sources tend to keep trying, so they are only logged when debugging
+		log.Debugf("%s", framework.CountError(ErrorBanned(addr, ban)))
+		return false
+	}
+	if !s.IPRate.Allow(ip, s.Config.RateLimitPerIP, s.Config.RateLimitInterval) {
+		log.Warningf("%s", framework.CountError(ErrorRateLimit(addr, ip)))
+		return false
+	}
+	if sub := subnet(ip, s.Config.SubnetPrefix, s.Config.SubnetPrefix6); !s.SubnetRate.Allow(sub, s.Config.RateLimitPerSubnet, s.Config.RateLimitInterval) {
+		log.Warningf("%s", framework.CountError(ErrorRateLimit(addr, sub)))
+		return false
+	}
+	if !s.Limit.Acquire(ip, s.Config.MaxConnections, s.Config.MaxConnectionsPerIP) {
+		log.Warningf("%s", framework.CountError(ErrorServiceLimit(addr)))
+		return false
+	}
+	return true
 }
 
 // AddRemote adds a new remote connection to this Service
-func (s *Service) AddRemote(conn net.Conn) {
+func (s *Service) AddRemote(conn net.Conn, log *logging.Logger) {
+	if !s.Admit(conn.RemoteAddr(), log) {
+		conn.Close()
+		return
+	}
+	s.AddAdmitted(conn, log)
+}
+
+// Admit checks the bans, rate limits and connection limits for a new client before it is added, taking a slot from the Service Limit if it is accepted
+func (s *Service) Admit(addr net.Addr, log *logging.Logger) bool {
 	s.Mutex.Lock()
-	s.Remotes = append(s.Remotes, CreateRemoteConnection(conn, s.Protocols, s, s.Engine))
-	s.Mutex.Unlock()
+	defer s.Mutex.Unlock()
+	return s.accepts(addr, log)
+}
+
+// Reserve takes a slot from the total of the Service Limit for a connection whose client is not known yet, like one that still has to send its PROXY protocol header
+func (s *Service) Reserve(addr net.Addr, log *logging.Logger) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if !s.Limit.Acquire(clientIP(addr), s.Config.MaxConnections, 0) {
+		log.Warningf("%s", framework.CountError(ErrorServiceLimit(addr)))
+		return false
+	}
+	return true
+}
+
+// AddAdmitted adds a new remote connection from a client that was already admitted to this Service
+func (s *Service) AddAdmitted(conn net.Conn, log *logging.Logger) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.Remotes = append(s.Remotes, CreateRemoteConnection(conn, s.Config, s.Protocols, s, s.Engine, log))
+}
+
+// RouteFlow picks the Protocol for a new datagram flow from its first datagram, returning nil if the flow is refused or unmatched
+//
+// A Protocol that is returned has taken a slot from both the Service Limit and its own Limit.
+func (s *Service) RouteFlow(addr net.Addr, datagram []byte, log *logging.Logger) *Protocol {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if !s.accepts(addr, log) {
+		return nil
+	}
+	ip := clientIP(addr)
+	for _, proto := range s.Protocols {
+		handler, ok := proto.Instance.(framework.DatagramHandler)
+		if !ok || !proto.ACL.Check(net.ParseIP(ip)) || !handler.MatchDatagram(datagram) {
+			continue
+		}
+		if !proto.Limit.Acquire(ip, proto.MaxConnections, proto.MaxConnectionsPerIP) {
+			log.Warningf("%s", framework.CountError(ErrorRemoteLimit(addr, proto)))
+			break
+		}
+		metricMatches.Inc(proto.Name, proto.RemoteName(), "won")
+		return proto
+	}
+	s.Limit.Release(ip)
+	return nil
 }
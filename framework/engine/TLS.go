@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// Certificates picks the certificate to present to a TLS client from the server name that it asks for
+type Certificates struct {
+	Pairs []*tls.Certificate
+	Names map[string]*tls.Certificate
+}
+
+// TerminatedConn is a connection that the engine terminates TLS on, which keeps the socket underneath so that its addresses can still be found
+type TerminatedConn struct {
+	*tls.Conn
+	Raw net.Conn
+}
+
+// ConfigureTLS loads the certificates for a service, returning nil if the service does not terminate TLS
+func ConfigureTLS(srv config.Service) (*tls.Config, error) {
+	if srv.TLS == nil {
+		return nil, nil
+	}
+	certs := &Certificates{
+		Pairs: make([]*tls.Certificate, len(srv.TLS.Certificates)),
+		Names: map[string]*tls.Certificate{},
+	}
+	for i, file := range srv.TLS.Certificates {
+		pair, err := tls.LoadX509KeyPair(file, srv.TLS.Keys[i])
+		if err != nil {
+			return nil, ErrorCertificate(file, err)
+		}
+		if pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return nil, ErrorCertificate(file, err)
+		}
+		certs.Pairs[i] = &pair
+		names := pair.Leaf.DNSNames
+		if len(names) == 0 && len(pair.Leaf.Subject.CommonName) > 0 {
+			names = []string{pair.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			// Earlier certificates win when two of them cover the same name
+			name = strings.ToLower(name)
+			if _, ok := certs.Names[name]; !ok {
+				certs.Names[name] = &pair
+			}
+		}
+	}
+	return &tls.Config{
+		GetCertificate: certs.Get,
+	}, nil
+}
+
+// Get finds the certificate for a server name, falling back to the first certificate for clients that do not send one or ask for an unknown name
+func (c *Certificates) Get(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if cert, ok := c.Names[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := c.Names["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return c.Pairs[0], nil
+}
+
+// Terminate starts terminating TLS on a connection, where the handshake happens on the first read or write
+func Terminate(conn net.Conn, cfg *tls.Config) *TerminatedConn {
+	return &TerminatedConn{
+		Conn: tls.Server(conn, cfg),
+		Raw:  conn,
+	}
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zachdeibert/protomux/admin"
+	"github.com/zachdeibert/protomux/framework"
+	"github.com/zachdeibert/protomux/metrics"
+)
+
+// upgradeTimeout is how long a new instance has to start before an upgrade is abandoned
+const upgradeTimeout = time.Minute
+
+// Upgrade starts a new instance of the program that takes over every listening socket, returning once it is accepting connections
+//
+// Once Upgrade succeeds the Engine should be drained and stopped, and closing its listeners no longer removes their unix domain sockets.
+// If the new instance fails to start, the Engine keeps listening as if nothing happened.
+// Under systemd the new instance is reported as the main process through NOTIFY_SOCKET, which systemd only accepts if the unit sets NotifyAccess (Type=notify does).
+// Without it, systemd takes the old instance exiting as the service stopping and kills the new one.
+func (e *Engine) Upgrade() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return ErrorUpgrade(err)
+	}
+	_, services := e.snapshot()
+	listeners := []*Listener{}
+	files := []*os.File{}
+	names := []string{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, ls := range services {
+		for _, l := range ls {
+			fs, err := l.Files()
+			if err != nil {
+				return ErrorUpgrade(err)
+			}
+			name := "unknown"
+			if l.Address.Network == "systemd" {
+				name = l.Address.Name
+			}
+			listeners = append(listeners, l)
+			for _, f := range fs {
+				files = append(files, f)
+				names = append(names, name)
+			}
+		}
+	}
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return ErrorUpgrade(err)
+	}
+	defer ready.Close()
+	e.Mutex.Lock()
+	e.releaseEndpoints()
+	e.Mutex.Unlock()
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(append([]*os.File{}, files...), notify)
+	cmd.Env = append(os.Environ(),
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		upgradePIDVariable+"="+strconv.Itoa(os.Getpid()),
+		readyFDVariable+"="+strconv.Itoa(listenFDsStart+len(files)))
+	err = cmd.Start()
+	notify.Close()
+	if err != nil {
+		e.restoreEndpoints()
+		return ErrorUpgrade(err)
+	}
+	e.Log.Infof("Started new process %d", cmd.Process.Pid)
+	// The pipe is closed without anything being written if the new instance exits before it is ready
+	ready.SetReadDeadline(time.Now().Add(upgradeTimeout))
+	if n, _ := ready.Read(make([]byte, 1)); n != 1 {
+		cmd.Process.Kill()
+		cmd.Wait()
+		e.restoreEndpoints()
+		return ErrorUpgrade(errors.New("the new process did not start"))
+	}
+	if err = notifyMainPID(cmd.Process.Pid); err != nil {
+		e.Log.Warningf("%s", framework.CountError(ErrorNotify(cmd.Process.Pid, err)))
+	}
+	cmd.Process.Release()
+	for _, l := range listeners {
+		l.KeepSocketFile()
+	}
+	return nil
+}
+
+// releaseEndpoints stops the metrics endpoint and admin socket so that the new instance can open them
+//
+// The caller must hold the Mutex.
+func (e *Engine) releaseEndpoints() {
+	if e.Metrics != nil {
+		e.Metrics.Stop()
+		e.Metrics = nil
+	}
+	if e.Admin != nil {
+		e.Admin.Stop()
+		e.Admin = nil
+	}
+}
+
+// restoreEndpoints opens the metrics endpoint and admin socket again after an upgrade failed
+func (e *Engine) restoreEndpoints() {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if e.Config.Metrics != nil {
+		if m, err := metrics.CreateServer(e.Config.Metrics.ListenAddresses, metrics.Default); err != nil {
+			e.Log.Errorf("%s", err)
+		} else {
+			e.Metrics = m
+			m.Start()
+		}
+	}
+	if e.Config.Admin != nil {
+		if a, err := admin.CreateServer(e.Config.Admin.Socket, e); err != nil {
+			e.Log.Errorf("%s", err)
+		} else {
+			e.Admin = a
+			a.Start()
+		}
+	}
+}
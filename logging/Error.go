@@ -0,0 +1,49 @@
+package logging
+
+import "fmt"
+
+// ErrorCode describes a specific error
+type ErrorCode int
+
+const (
+	// ErrorCodeUnknownLevel represents when a log level name is not recognized
+	ErrorCodeUnknownLevel ErrorCode = iota
+	// ErrorCodeUnknownFormat represents when a log format name is not recognized
+	ErrorCodeUnknownFormat ErrorCode = iota
+	// ErrorCodeOpenFile represents when the log file cannot be opened
+	ErrorCodeOpenFile ErrorCode = iota
+)
+
+// Error describes an error with the logging configuration
+type Error struct {
+	Message string
+	Code    ErrorCode
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// ErrorUnknownLevel creates a new ErrorUnknownLevel error
+func ErrorUnknownLevel(name string) error {
+	return &Error{
+		Message: fmt.Sprintf("Unknown log level '%s'", name),
+		Code:    ErrorCodeUnknownLevel,
+	}
+}
+
+// ErrorUnknownFormat creates a new ErrorUnknownFormat error
+func ErrorUnknownFormat(name string) error {
+	return &Error{
+		Message: fmt.Sprintf("Unknown log format '%s'", name),
+		Code:    ErrorCodeUnknownFormat,
+	}
+}
+
+// ErrorOpenFile creates a new ErrorOpenFile error
+func ErrorOpenFile(file string, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to open log file '%s': %s", file, err),
+		Code:    ErrorCodeOpenFile,
+	}
+}
@@ -0,0 +1,7 @@
+package logging
+
+// Field is a piece of context that is attached to log messages
+type Field struct {
+	Key   string
+	Value interface{}
+}
@@ -0,0 +1,23 @@
+package logging
+
+// Format represents how log messages are written out
+type Format int
+
+const (
+	// FormatText writes each message as a line of text followed by key=value fields
+	FormatText Format = iota
+	// FormatJSON writes each message as a JSON object on its own line
+	FormatJSON Format = iota
+)
+
+// ParseFormat parses the name of a Format
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return 0, ErrorUnknownFormat(name)
+	}
+}
@@ -0,0 +1,35 @@
+package logging
+
+// Level represents how important a log message is
+type Level int
+
+const (
+	// LevelDebug is for messages that are only useful when diagnosing a problem
+	LevelDebug Level = iota
+	// LevelInfo is for messages about normal operation
+	LevelInfo Level = iota
+	// LevelWarning is for problems with a single connection
+	LevelWarning Level = iota
+	// LevelError is for problems that affect the whole program
+	LevelError Level = iota
+)
+
+// levelNames are the names of each Level, in the same order as the constants
+var levelNames = []string{"debug", "info", "warning", "error"}
+
+// ParseLevel parses the name of a Level
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if n == name {
+			return Level(i), nil
+		}
+	}
+	return 0, ErrorUnknownLevel(name)
+}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return "unknown"
+	}
+	return levelNames[l]
+}
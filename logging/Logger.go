@@ -0,0 +1,72 @@
+package logging
+
+import "fmt"
+
+// Logger writes log messages with a set of fields that describe where they came from
+type Logger struct {
+	Output *Output
+	Fields []Field
+}
+
+// CreateLogger creates a new Logger
+func CreateLogger(output *Output) *Logger {
+	return &Logger{
+		Output: output,
+		Fields: []Field{},
+	}
+}
+
+// With creates a Logger that adds another field to every message
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]Field, len(l.Fields), len(l.Fields)+1)
+	copy(fields, l.Fields)
+	for i, f := range fields {
+		if f.Key == key {
+			fields[i].Value = value
+			return &Logger{
+				Output: l.Output,
+				Fields: fields,
+			}
+		}
+	}
+	return &Logger{
+		Output: l.Output,
+		Fields: append(fields, Field{
+			Key:   key,
+			Value: value,
+		}),
+	}
+}
+
+// Enabled determines if messages at a Level would be written
+func (l *Logger) Enabled(level Level) bool {
+	return l.Output.Enabled(level)
+}
+
+// Log writes a message
+func (l *Logger) Log(level Level, format string, args ...interface{}) {
+	if !l.Output.Enabled(level) {
+		return
+	}
+	l.Output.Write(level, fmt.Sprintf(format, args...), l.Fields)
+}
+
+// Debugf writes a message that is only useful when diagnosing a problem
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Log(LevelDebug, format, args...)
+}
+
+// Infof writes a message about normal operation
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Log(LevelInfo, format, args...)
+}
+
+// Warningf writes a message about a problem with a single connection
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.Log(LevelWarning, format, args...)
+}
+
+// Errorf writes a message about a problem that affects the whole program
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Log(LevelError, format, args...)
+}
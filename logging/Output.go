@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output is where log messages end up, shared by every Logger that writes to it
+type Output struct {
+	Writer io.Writer
+	File   *os.File
+	Level  Level
+	Format Format
+	Mutex  sync.Mutex
+}
+
+// CreateOutput creates a new Output that writes messages of at least the named level in the named format to a file, or to stdout if path is empty
+func CreateOutput(levelName, formatName, path string) (*Output, error) {
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return nil, err
+	}
+	format, err := ParseFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+	var writer io.Writer = os.Stdout
+	var file *os.File = nil
+	if path != "" {
+		if file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+			return nil, ErrorOpenFile(path, err)
+		}
+		writer = file
+	}
+	return &Output{
+		Writer: writer,
+		File:   file,
+		Level:  level,
+		Format: format,
+	}, nil
+}
+
+// Replace makes the Output write where another one would, so that the Loggers sharing it pick up a new configuration and the log file can be rotated
+//
+// The other Output must not be used afterwards.
+func (o *Output) Replace(other *Output) {
+	o.Mutex.Lock()
+	old := o.File
+	o.Writer = other.Writer
+	o.File = other.File
+	o.Level = other.Level
+	o.Format = other.Format
+	o.Mutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+// Enabled determines if messages at a Level are written
+func (o *Output) Enabled(level Level) bool {
+	o.Mutex.Lock()
+	defer o.Mutex.Unlock()
+	return level >= o.Level
+}
+
+// Write a message to the Output
+func (o *Output) Write(level Level, message string, fields []Field) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	o.Mutex.Lock()
+	defer o.Mutex.Unlock()
+	if level < o.Level {
+		return
+	}
+	buf := strings.Builder{}
+	switch o.Format {
+	case FormatText:
+		buf.WriteString(fmt.Sprintf("%s %-7s %s", now, strings.ToUpper(level.String()), message))
+		for _, f := range fields {
+			val := fmt.Sprint(f.Value)
+			if val == "" || strings.ContainsAny(val, " \t\r\n\"=") {
+				val = strconv.Quote(val)
+			}
+			buf.WriteString(fmt.Sprintf(" %s=%s", f.Key, val))
+		}
+		break
+	case FormatJSON:
+		buf.WriteString(fmt.Sprintf(`{"time":%s,"level":%s,"message":%s`, marshal(now), marshal(level.String()), marshal(message)))
+		for _, f := range fields {
+			buf.WriteString(fmt.Sprintf(",%s:%s", marshal(f.Key), marshal(f.Value)))
+		}
+		buf.WriteRune('}')
+		break
+	}
+	buf.WriteRune('\n')
+	io.WriteString(o.Writer, buf.String())
+}
+
+// Close the log file
+func (o *Output) Close() error {
+	o.Mutex.Lock()
+	defer o.Mutex.Unlock()
+	if o.File == nil {
+		return nil
+	}
+	err := o.File.Close()
+	o.Writer = os.Stdout
+	o.File = nil
+	return err
+}
+
+func marshal(val interface{}) string {
+	switch v := val.(type) {
+	case error:
+		val = v.Error()
+		break
+	case fmt.Stringer:
+		val = v.String()
+		break
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(val))
+	}
+	return string(data)
+}
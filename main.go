@@ -6,14 +6,20 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/zachdeibert/protomux/admin"
 	"github.com/zachdeibert/protomux/config"
 	"github.com/zachdeibert/protomux/config/cmd"
+	"github.com/zachdeibert/protomux/framework"
 	"github.com/zachdeibert/protomux/framework/engine"
 
 	_ "github.com/zachdeibert/protomux/protocols/minecraft"
+	_ "github.com/zachdeibert/protomux/protocols/passthrough"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(admin.Ctl(os.Args[0], os.Args[2:], os.Stdout, os.Stderr))
+	}
 	cfg, _, err := config.LoadCommandLine(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -33,10 +39,40 @@ func main() {
 		os.Exit(1)
 	}
 	eng.Start()
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	fmt.Println("ProtoMux started.")
-	<-c
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
+	eng.Log.Infof("ProtoMux started.")
+	for sig := range c {
+		if sig == syscall.SIGUSR2 {
+			if err := eng.Upgrade(); err != nil {
+				eng.Log.Errorf("%s", framework.CountError(err))
+				continue
+			}
+			eng.Log.Infof("ProtoMux handed its listeners to the new process.")
+			break
+		}
+		if sig != syscall.SIGHUP {
+			break
+		}
+		next, _, err := config.LoadCommandLine(os.Args[1:])
+		if err != nil {
+			eng.Log.Errorf("Unable to reload configuration: %s", err)
+			continue
+		}
+		if err = eng.Reload(*next); err != nil {
+			eng.Log.Errorf("Unable to reload configuration: %s", framework.CountError(err))
+			continue
+		}
+		eng.Log.Infof("ProtoMux reloaded.")
+	}
+	eng.Log.Infof("ProtoMux stopping.")
+	abort := make(chan struct{})
+	go func() {
+		// A second signal skips the rest of the grace period
+		<-c
+		close(abort)
+	}()
+	eng.Drain(eng.Config.ShutdownGrace, abort)
 	eng.Stop()
-	fmt.Println("ProtoMux stopped.")
+	eng.Log.Infof("ProtoMux stopped.")
 }
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Counter is a set of values that only go up, one for each combination of labels
+type Counter struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+	Values map[string]*Value
+	Mutex  sync.Mutex
+}
+
+// With gets the Value for a combination of labels
+func (c *Counter) With(labels ...string) *Value {
+	checkLabels(c.Name, c.Labels, labels)
+	key := strings.Join(labels, labelSeparator)
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	v, ok := c.Values[key]
+	if !ok {
+		v = &Value{}
+		c.Values[key] = v
+	}
+	return v
+}
+
+// Add to the value for a combination of labels
+func (c *Counter) Add(delta float64, labels ...string) {
+	c.With(labels...).Add(delta)
+}
+
+// Inc adds one to the value for a combination of labels
+func (c *Counter) Inc(labels ...string) {
+	c.With(labels...).Inc()
+}
+
+// Write the Counter in the Prometheus text format
+func (c *Counter) Write(w io.Writer) error {
+	c.Mutex.Lock()
+	keys := make([]string, 0, len(c.Values))
+	for k := range c.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", c.Name, c.Help, c.Name, c.Type))
+	for _, k := range keys {
+		var labels []string
+		if len(c.Labels) > 0 {
+			labels = strings.Split(k, labelSeparator)
+		}
+		buf.WriteString(fmt.Sprintf("%s%s %s\n", c.Name, formatLabels(c.Labels, labels), formatValue(c.Values[k].Get())))
+	}
+	c.Mutex.Unlock()
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
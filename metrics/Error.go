@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// ErrorCode describes a specific error
+type ErrorCode int
+
+const (
+	// ErrorCodeListenStart represents when the metrics endpoint could not start listening
+	ErrorCodeListenStart ErrorCode = iota
+)
+
+// Error describes an error with the metrics endpoint
+type Error struct {
+	Message string
+	Code    ErrorCode
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// ErrorListenStart creates a new ErrorListenStart error
+func ErrorListenStart(addr config.Connection, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to start metrics endpoint on %s: %s", addr, err),
+		Code:    ErrorCodeListenStart,
+	}
+}
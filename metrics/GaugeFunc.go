@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Sample is one value of a GaugeFunc
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc is a gauge whose values are computed each time it is scraped
+type GaugeFunc struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Collect func() []Sample
+}
+
+// Write the GaugeFunc in the Prometheus text format
+func (g *GaugeFunc) Write(w io.Writer) error {
+	samples := g.Collect()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Labels, labelSeparator) < strings.Join(samples[j].Labels, labelSeparator)
+	})
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n", g.Name, g.Help, g.Name))
+	for _, s := range samples {
+		checkLabels(g.Name, g.Labels, s.Labels)
+		buf.WriteString(fmt.Sprintf("%s%s %s\n", g.Name, formatLabels(g.Labels, s.Labels), formatValue(s.Value)))
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
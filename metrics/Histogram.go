@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// histogramValues are the observations for one combination of labels
+type histogramValues struct {
+	Buckets []uint64
+	Sum     float64
+	Count   uint64
+}
+
+// Histogram counts observations into buckets, one set for each combination of labels
+type Histogram struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+	Values  map[string]*histogramValues
+	Mutex   sync.Mutex
+}
+
+// Observe a value for a combination of labels
+func (h *Histogram) Observe(val float64, labels ...string) {
+	checkLabels(h.Name, h.Labels, labels)
+	key := strings.Join(labels, labelSeparator)
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	v, ok := h.Values[key]
+	if !ok {
+		v = &histogramValues{
+			Buckets: make([]uint64, len(h.Buckets)),
+		}
+		h.Values[key] = v
+	}
+	for i, b := range h.Buckets {
+		if val <= b {
+			v.Buckets[i]++
+		}
+	}
+	v.Sum += val
+	v.Count++
+}
+
+// Write the Histogram in the Prometheus text format
+func (h *Histogram) Write(w io.Writer) error {
+	h.Mutex.Lock()
+	keys := make([]string, 0, len(h.Values))
+	for k := range h.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s histogram\n", h.Name, h.Help, h.Name))
+	for _, k := range keys {
+		var labels []string
+		if len(h.Labels) > 0 {
+			labels = strings.Split(k, labelSeparator)
+		}
+		v := h.Values[k]
+		for i, b := range h.Buckets {
+			buf.WriteString(fmt.Sprintf("%s_bucket%s %d\n", h.Name, formatLabels(h.Labels, labels, "le", formatValue(b)), v.Buckets[i]))
+		}
+		buf.WriteString(fmt.Sprintf("%s_bucket%s %d\n", h.Name, formatLabels(h.Labels, labels, "le", "+Inf"), v.Count))
+		buf.WriteString(fmt.Sprintf("%s_sum%s %s\n", h.Name, formatLabels(h.Labels, labels), formatValue(v.Sum)))
+		buf.WriteString(fmt.Sprintf("%s_count%s %d\n", h.Name, formatLabels(h.Labels, labels), v.Count))
+	}
+	h.Mutex.Unlock()
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// labelSeparator joins label values into a map key, and cannot appear in valid UTF-8
+const labelSeparator = "\xff"
+
+// formatLabels formats label names and values in the Prometheus text format, including the braces
+func formatLabels(names []string, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabel(extra[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeLabel(val string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(val)
+}
+
+func formatValue(val float64) string {
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+// checkLabels panics if the wrong number of label values are given, since that is a programming error
+func checkLabels(name string, names []string, values []string) {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metric %s has %d labels but was given %d values", name, len(names), len(values)))
+	}
+}
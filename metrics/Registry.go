@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+// Metric is anything that can be written in the Prometheus text format
+type Metric interface {
+	Write(w io.Writer) error
+}
+
+// Registry is a set of metrics that are exported together
+type Registry struct {
+	Metrics map[string]Metric
+	Mutex   sync.Mutex
+}
+
+// Default is the Registry that the metrics endpoint serves
+var Default = CreateRegistry()
+
+// CreateRegistry creates a new Registry
+func CreateRegistry() *Registry {
+	return &Registry{
+		Metrics: map[string]Metric{},
+	}
+}
+
+// Register a Metric, replacing any other Metric with the same name
+func (r *Registry) Register(name string, m Metric) {
+	r.Mutex.Lock()
+	r.Metrics[name] = m
+	r.Mutex.Unlock()
+}
+
+// Counter creates and registers a new Counter
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		Name:   name,
+		Help:   help,
+		Type:   "counter",
+		Labels: labels,
+		Values: map[string]*Value{},
+	}
+	r.Register(name, c)
+	return c
+}
+
+// Gauge creates and registers a new gauge, which works like a Counter that can also go down
+func (r *Registry) Gauge(name, help string, labels ...string) *Counter {
+	c := r.Counter(name, help, labels...)
+	c.Type = "gauge"
+	return c
+}
+
+// GaugeFunc creates and registers a new GaugeFunc
+func (r *Registry) GaugeFunc(name, help string, collect func() []Sample, labels ...string) *GaugeFunc {
+	g := &GaugeFunc{
+		Name:    name,
+		Help:    help,
+		Labels:  labels,
+		Collect: collect,
+	}
+	r.Register(name, g)
+	return g
+}
+
+// Histogram creates and registers a new Histogram
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		Name:    name,
+		Help:    help,
+		Labels:  labels,
+		Buckets: buckets,
+		Values:  map[string]*histogramValues{},
+	}
+	r.Register(name, h)
+	return h
+}
+
+// Write every Metric in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.Mutex.Lock()
+	names := make([]string, 0, len(r.Metrics))
+	for name := range r.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]Metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.Metrics[name]
+	}
+	r.Mutex.Unlock()
+	for _, m := range metrics {
+		if err := m.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
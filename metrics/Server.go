@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// Server serves the metrics in a Registry over HTTP
+type Server struct {
+	Registry  *Registry
+	Addresses []config.Connection
+	Listeners []net.Listener
+	HTTP      *http.Server
+	WaitGroup sync.WaitGroup
+}
+
+// CreateServer creates a new Server and starts listening
+func CreateServer(addresses []config.Connection, registry *Registry) (*Server, error) {
+	s := &Server{
+		Registry:  registry,
+		Addresses: addresses,
+		Listeners: []net.Listener{},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s)
+	s.HTTP = &http.Server{
+		Handler: mux,
+	}
+	for _, addr := range addresses {
+		l, err := framework.Listen(addr)
+		if err != nil {
+			for _, l := range s.Listeners {
+				l.Close()
+			}
+			return nil, ErrorListenStart(addr, err)
+		}
+		s.Listeners = append(s.Listeners, l)
+	}
+	return s, nil
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.Registry.Write(w)
+}
+
+// Start serving requests
+func (s *Server) Start() {
+	for _, l := range s.Listeners {
+		s.WaitGroup.Add(1)
+		go func(l net.Listener) {
+			defer s.WaitGroup.Done()
+			s.HTTP.Serve(l)
+		}(l)
+	}
+}
+
+// Stop serving requests
+func (s *Server) Stop() {
+	s.HTTP.Close()
+	s.WaitGroup.Wait()
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Value is a single number that can be updated from multiple goroutines
+type Value struct {
+	Bits uint64
+}
+
+// Add to the Value
+func (v *Value) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.Bits)
+		if atomic.CompareAndSwapUint64(&v.Bits, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Inc adds one to the Value
+func (v *Value) Inc() {
+	v.Add(1)
+}
+
+// Set the Value
+func (v *Value) Set(val float64) {
+	atomic.StoreUint64(&v.Bits, math.Float64bits(val))
+}
+
+// Get the Value
+func (v *Value) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.Bits))
+}
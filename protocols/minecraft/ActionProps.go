@@ -1,20 +1,28 @@
 package minecraft
 
-import "github.com/zachdeibert/protomux/config"
+import (
+	"time"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/config/common"
+)
 
 // ActionProps represents properties that are used for actions to run once a connection is received
 type ActionProps struct {
 	Remote *config.Connection
 	MOTD   *string
 	Kick   *string
+	// StatusCacheTTL is how long status responses from the remote are cached for, or zero to disable caching
+	StatusCacheTTL time.Duration
 }
 
 // ParseActionProps parses the ActionProps from Parameters
 func ParseActionProps(global config.Parameters, local config.Parameters) (*ActionProps, []string, []string, error) {
 	props := &ActionProps{
-		Remote: nil,
-		MOTD:   nil,
-		Kick:   nil,
+		Remote:         nil,
+		MOTD:           nil,
+		Kick:           nil,
+		StatusCacheTTL: 0,
 	}
 	globalUsed := []string{}
 	localUsed := []string{}
@@ -69,6 +77,27 @@ func ParseActionProps(global config.Parameters, local config.Parameters) (*Actio
 			props.Kick = &val[0]
 		}
 	}
+	{
+		var val []string = nil
+		var location common.Location
+		if v, ok := global.Strings["statusCacheTtl"]; ok {
+			globalUsed = append(globalUsed, "statusCacheTtl")
+			val = v
+			location = global.Locations["statusCacheTtl"]
+		}
+		if v, ok := local.Strings["statusCacheTtl"]; ok {
+			localUsed = append(localUsed, "statusCacheTtl")
+			val = v
+			location = local.Locations["statusCacheTtl"]
+		}
+		if val != nil {
+			ttl, err := config.ParseDuration("statusCacheTtl", "Minecraft server", val, location)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			props.StatusCacheTTL = ttl
+		}
+	}
 	if props.Remote != nil && props.Kick != nil {
 		return nil, nil, nil, ErrorParameterRequirement("Both 'remote' and 'kick' may not be specified on the same server")
 	}
@@ -78,5 +107,8 @@ func ParseActionProps(global config.Parameters, local config.Parameters) (*Actio
 	if props.Remote == nil && props.Kick == nil {
 		return nil, nil, nil, ErrorParameterRequirement("Either 'remote' or 'kick' must be specified on every server")
 	}
+	if props.Remote == nil && props.StatusCacheTTL != 0 {
+		return nil, nil, nil, ErrorParameterRequirement("'statusCacheTtl' may only be specified on a server with a 'remote'")
+	}
 	return props, globalUsed, localUsed, nil
 }
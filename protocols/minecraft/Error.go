@@ -24,6 +24,23 @@ const (
 	ErrorCodeProtocol ErrorCode = iota
 )
 
+// errorCodeNames are the names of each ErrorCode in the metrics, in the same order as the constants
+var errorCodeNames = []string{
+	"invalid_version",
+	"multiple_values",
+	"parameter_requirement",
+	"unrecognized_parameter",
+	"unknown_remote_type",
+	"protocol",
+}
+
+func (c ErrorCode) String() string {
+	if c < 0 || int(c) >= len(errorCodeNames) {
+		return "unknown"
+	}
+	return errorCodeNames[c]
+}
+
 // Error describes an error with the Minecraft protocol implementation
 type Error struct {
 	Message string
@@ -34,6 +51,11 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// Count the error in the metrics
+func (e Error) Count() {
+	metricErrors.Inc(e.Code.String())
+}
+
 // ErrorInvalidVersion creates a new ErrorInvalidVersion error
 func ErrorInvalidVersion(version string) error {
 	return &Error{
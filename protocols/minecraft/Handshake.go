@@ -0,0 +1,119 @@
+package minecraft
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/zachdeibert/protomux/config"
+)
+
+// maxHostLength is the longest server address that a client can send in a handshake
+const maxHostLength = 255
+
+// Handshake contains the information a client sends about the server it is connecting to
+type Handshake struct {
+	Version   int
+	Address   string
+	Port      uint16
+	NextState int
+}
+
+// ReadHandshake reads the handshake packet that clients after the Netty rewrite send first
+func ReadHandshake(reader *Reader) (*Handshake, error) {
+	pkt, id, err := reader.ReadUncompressedPacket()
+	if err != nil {
+		return nil, err
+	}
+	if id != 0 {
+		return nil, ErrorProtocol("Expected handshake packet")
+	}
+	version, err := pkt.ReadVarInt()
+	if err != nil {
+		return nil, ErrorProtocol("Truncated handshake packet")
+	}
+	addr, err := pkt.ReadBoundedString(maxHostLength)
+	if err != nil {
+		return nil, ErrorProtocol("Invalid server address in handshake packet")
+	}
+	port, err := pkt.ReadUShort()
+	if err != nil {
+		return nil, ErrorProtocol("Truncated handshake packet")
+	}
+	nextState, err := pkt.ReadVarInt()
+	if err != nil {
+		return nil, ErrorProtocol("Truncated handshake packet")
+	}
+	return &Handshake{
+		Version:   version,
+		Address:   addr,
+		Port:      port,
+		NextState: nextState,
+	}, nil
+}
+
+// ReadPingHost reads the MC|PingHost plugin message that 1.6 clients send after the server list ping
+func ReadPingHost(reader *Reader) (*Handshake, error) {
+	id, err := reader.ReadUByte()
+	if err != nil {
+		return nil, err
+	}
+	if id != 0xFA {
+		return nil, ErrorProtocol("Expected plugin message packet")
+	}
+	channel, err := reader.ReadUTF16String()
+	if err != nil {
+		return nil, err
+	}
+	if channel != "MC|PingHost" {
+		return nil, ErrorProtocol("Expected MC|PingHost plugin message")
+	}
+	if _, err = reader.ReadUShort(); err != nil {
+		return nil, err
+	}
+	version, err := reader.ReadUByte()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := reader.ReadUTF16String()
+	if err != nil {
+		return nil, err
+	}
+	port, err := reader.ReadUInt()
+	if err != nil {
+		return nil, err
+	}
+	return &Handshake{
+		Version:   int(version),
+		Address:   addr,
+		Port:      uint16(port),
+		NextState: 1,
+	}, nil
+}
+
+// State gets the name of the state the client asked to switch to
+func (h Handshake) State() string {
+	switch h.NextState {
+	case 1:
+		return "status"
+	case 2:
+		return "login"
+	default:
+		return fmt.Sprint(h.NextState)
+	}
+}
+
+// FilteringProps gets the properties of the Handshake that servers are filtered by
+func (h Handshake) FilteringProps() FilteringProps {
+	c := config.Connection{
+		Port: int(h.Port),
+	}
+	if ip := net.ParseIP(h.Address); ip == nil {
+		c.Host = h.Address
+	} else {
+		c.IP = ip
+	}
+	return FilteringProps{
+		Version:       []Version{Version(h.Version)},
+		ServerAddress: []config.Connection{c},
+	}
+}
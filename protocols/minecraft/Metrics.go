@@ -0,0 +1,5 @@
+package minecraft
+
+import "github.com/zachdeibert/protomux/metrics"
+
+var metricErrors = metrics.Default.Counter("protomux_minecraft_errors_total", "Errors from the Minecraft protocol by type", "type")
@@ -3,91 +3,87 @@ package minecraft
 import (
 	"bufio"
 	"fmt"
-	"net"
+	"time"
 
 	"github.com/zachdeibert/protomux/config"
 	"github.com/zachdeibert/protomux/framework"
 )
 
+// statusFetchTimeout is how long a remote has to answer a status request for the StatusCache
+const statusFetchTimeout = 5 * time.Second
+
+// serverFullMessage is what logins are kicked with when the remote is at its connection limit
+const serverFullMessage = "Server is full"
+
 // HandleNettyRewrite handles the protocol for clients that have the Netty rewrite
-func (p ProtocolInstance) HandleNettyRewrite(conn framework.Connection, stream *bufio.Reader) error {
+func (p ProtocolInstance) HandleNettyRewrite(conn framework.Connection, stream *bufio.Reader, recorder *framework.Recorder) error {
 	reader := CreateReader(stream)
 	writer := CreateWriter(conn)
-	pkt, id, err := reader.ReadUncompressedPacket()
-	if err != nil {
-		return err
-	}
-	if id != 0 {
-		return ErrorProtocol("Expected handshake packet")
-	}
-	version, err := pkt.ReadVarInt()
-	if err != nil {
-		return err
-	}
-	addr, err := pkt.ReadString()
+	handshake, err := ReadHandshake(reader)
 	if err != nil {
 		return err
 	}
-	port, err := pkt.ReadUShort()
-	if err != nil {
-		return err
-	}
-	c := config.Connection{
-		Port: int(port),
-	}
-	if ip := net.ParseIP(addr); ip == nil {
-		c.Host = addr
-	} else {
-		c.IP = ip
-	}
-	filterData := FilteringProps{
-		Version:       []Version{Version(version)},
-		ServerAddress: []config.Connection{c},
-	}
-	if !filterData.Check(p.Filter) {
-		return ErrorProtocol("Filter mismatch")
+	conn.Annotate("hostname", handshake.Address)
+	conn.Annotate("version", handshake.Version)
+	conn.Annotate("nextState", handshake.State())
+	if !handshake.FilteringProps().Check(p.Filter) {
+		conn.Logger().Debugf("Handshake for %s:%d version %d does not match the filter", handshake.Address, handshake.Port, handshake.Version)
+		return nil
 	}
 	priority := 1
-	if filterData.IsEmpty() {
+	if p.Filter.IsEmpty() {
 		priority = 0
 	}
+	// Only logins that are proxied count against the limits of the remote, so that the server list still shows it while it is full
 	if err = conn.RequireExclusive(priority); err != nil {
 		return err
 	}
-	nextState, err := pkt.ReadVarInt()
-	if err != nil {
-		return err
-	}
-	switch nextState {
+	version := handshake.Version
+	switch handshake.NextState {
 	case 1: // status
-		if p.Action.MOTD == nil {
-			// TODO proxy
-			return ErrorProtocol("Status proxying")
+		if p.Action.MOTD == nil && p.Status == nil {
+			return framework.Proxy(conn, *p.Action.Remote, recorder.Data)
 		}
-		_, id, err = reader.ReadUncompressedPacket()
+		_, id, err := reader.ReadUncompressedPacket()
 		if err != nil {
 			return err
 		}
 		if id != 0 {
 			return ErrorProtocol("Expected status packet")
 		}
-		versionName := ""
-		for i, v := range p.Filter.Version {
-			if v == Version(version) {
-				versionName = p.Filter.VersionName[i]
+		var status string
+		if p.Action.MOTD != nil {
+			versionName := ""
+			for i, v := range p.Filter.Version {
+				if v == Version(version) {
+					versionName = p.Filter.VersionName[i]
+				}
 			}
-		}
-		if versionName == "" {
-			var ok bool
-			if versionName, ok = NettyVersionNames[Version(version)]; !ok {
-				versionName = "unknown"
+			if versionName == "" {
+				var ok bool
+				if versionName, ok = NettyVersionNames[Version(version)]; !ok {
+					versionName = "unknown"
+				}
+			}
+			status = fmt.Sprintf(`{"version":{"name":"%s","protocol":%d},"players":{"max":0,"online":0,"sample":[]},"description":{"text":"%s"}}`, versionName, version, *p.Action.MOTD)
+		} else {
+			key := StatusCacheKey{
+				Version: Version(version),
+				Address: handshake.Address,
+				Port:    handshake.Port,
+			}
+			status, err = p.Status.Get(key, func() (string, error) {
+				return FetchStatus(*p.Action.Remote, conn.ProxyProtocol(), version, handshake.Address, handshake.Port)
+			})
+			if err != nil {
+				conn.Logger().Warningf("Unable to fetch status from %s: %s", p.Action.Remote, framework.CountError(err))
+				return nil
 			}
 		}
-		status := fmt.Sprintf(`{"version":{"name":"%s","protocol":%d},"players":{"max":0,"online":0,"sample":[]},"description":{"text":"%s"}}`, versionName, version, *p.Action.MOTD)
 		wpkt := writer.WriteUncompressedPacket(0)
 		wpkt.WriteString(status)
 		wpkt.Close()
-		pkt, id, err = reader.ReadUncompressedPacket()
+		pkt, id, err := reader.ReadUncompressedPacket()
 		if err != nil {
 			return err
 		}
@@ -104,9 +100,15 @@ func (p ProtocolInstance) HandleNettyRewrite(conn framework.Connection, stream *
 		return nil
 	case 2: // login
 		if p.Action.Remote != nil {
-			// TODO proxy
-			return ErrorProtocol("Login not supported")
+			if err = conn.AcquireSlot(); err == framework.ErrorRemoteFull {
+				return DisconnectLogin(conn, serverFullMessage)
+			} else if err != nil {
+				return err
+			}
 		}
+		conn.SetGoodbye(func(reason string) error {
+			return DisconnectLogin(conn, reason)
+		})
 		pkt, id, err := reader.ReadUncompressedPacket()
 		if err != nil {
 			return err
@@ -118,16 +120,75 @@ func (p ProtocolInstance) HandleNettyRewrite(conn framework.Connection, stream *
 		if err != nil {
 			return err
 		}
+		// The backend or the kick message is in charge of the stream from here on
+		conn.SetGoodbye(nil)
+		conn.Annotate("username", username)
+		if p.Action.Remote != nil {
+			conn.Logger().Infof("Proxying login to %s", p.Action.Remote)
+			backend, err := framework.Connect(conn, *p.Action.Remote, recorder.Data)
+			if err != nil {
+				return err
+			}
+			// The session is only interrupted if it is still going when the grace period runs out
+			session := CreateSession(conn, Version(version))
+			conn.SetFarewell(session.Farewell)
+			return framework.Splice(session, backend)
+		}
+		conn.Logger().Infof("Kicking login: %s", *p.Action.Kick)
 		wpkt := writer.WriteUncompressedPacket(0x02)
 		wpkt.WriteString("00000000-0000-0000-0000-000000000000")
 		wpkt.WriteString(username)
 		wpkt.Close()
-		reason := fmt.Sprintf(`{"text":"%s"}`, *p.Action.Kick)
 		wpkt = writer.WriteUncompressedPacket(0x1B)
-		wpkt.WriteString(reason)
+		wpkt.WriteChat(*p.Action.Kick)
 		wpkt.Close()
 		return nil
 	default:
 		return ErrorProtocol("Unknown next state")
 	}
 }
+
+// DisconnectLogin sends the packet that tells a client in the login state why it is being disconnected
+func DisconnectLogin(conn framework.Connection, reason string) error {
+	wpkt := CreateWriter(conn).WriteUncompressedPacket(0x00)
+	wpkt.WriteChat(reason)
+	return wpkt.Close()
+}
+
+// FetchStatus requests the status response from a remote server, starting with a PROXY protocol header if the remote expects one
+func FetchStatus(remote config.Connection, proxyProtocol string, version int, addr string, port uint16) (string, error) {
+	conn, err := framework.DialTimeout(remote, statusFetchTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	// Every ping for the remote waits on this fetch, so a remote that stops answering cannot hold them up for long
+	conn.SetDeadline(time.Now().Add(statusFetchTimeout))
+	if proxyProtocol != "" {
+		// The response is cached for every client, so the request comes from protomux itself
+		if _, err = conn.Write(framework.ProxyHeader(proxyProtocol, nil, nil)); err != nil {
+			return "", err
+		}
+	}
+	reader := CreateReader(bufio.NewReader(conn))
+	writer := CreateWriter(conn)
+	wpkt := writer.WriteUncompressedPacket(0)
+	wpkt.WriteVarInt(version)
+	wpkt.WriteString(addr)
+	wpkt.WriteUShort(port)
+	wpkt.WriteVarInt(1)
+	if err = wpkt.Close(); err != nil {
+		return "", err
+	}
+	if err = writer.WriteUncompressedPacket(0).Close(); err != nil {
+		return "", err
+	}
+	pkt, id, err := reader.ReadUncompressedPacket()
+	if err != nil {
+		return "", err
+	}
+	if id != 0 {
+		return "", ErrorProtocol("Expected status response packet")
+	}
+	return pkt.ReadString()
+}
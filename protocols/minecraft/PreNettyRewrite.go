@@ -0,0 +1,133 @@
+package minecraft
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// legacyPingWait is how long a client from before the Netty rewrite is given to send the rest of its server list ping
+const legacyPingWait = 500 * time.Millisecond
+
+// legacyPingReplayWait is how long the rest of a server list ping is waited on once it has been matched
+//
+// A short ping is only matched after the client was quiet for legacyPingWait, so anything it sent is already recorded.
+const legacyPingReplayWait = 50 * time.Millisecond
+
+// HandlePreNettyRewrite handles the server list ping for clients from before the Netty rewrite
+func (p ProtocolInstance) HandlePreNettyRewrite(conn framework.Connection, stream *bufio.Reader, recorder *framework.Recorder) error {
+	reader := CreateReader(stream)
+	writer := CreateWriter(conn)
+	id, err := reader.ReadUByte()
+	if err != nil {
+		return err
+	}
+	if id != 0xFE {
+		return ErrorProtocol("Expected server list ping packet")
+	}
+	// Beta 1.8 through 1.3 only send the packet id
+	legacy := true
+	version := -1
+	filterData := FilteringProps{
+		Version:       []Version{},
+		ServerAddress: []config.Connection{},
+	}
+	// Older clients send nothing more, so the rest of the ping is only waited on for a moment
+	if err = conn.SetReadDeadline(time.Now().Add(legacyPingReplayWait)); err != nil {
+		return err
+	}
+	more, err := pingContinues(stream)
+	if err != nil {
+		return err
+	}
+	if more {
+		// 1.4 and 1.5 send a payload byte
+		payload, err := reader.ReadUByte()
+		if err != nil {
+			return err
+		}
+		if payload != 1 {
+			return ErrorProtocol("Unexpected server list ping payload")
+		}
+		legacy = false
+		if more, err = pingContinues(stream); err != nil {
+			return err
+		}
+		if more {
+			// 1.6 sends a plugin message containing the version and address
+			handshake, err := ReadPingHost(reader)
+			if err != nil {
+				return err
+			}
+			version = handshake.Version
+			filterData = handshake.FilteringProps()
+			conn.Annotate("hostname", handshake.Address)
+			conn.Annotate("version", handshake.Version)
+		}
+	}
+	if err = conn.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	conn.Annotate("nextState", "legacy status")
+	if !filterData.Check(p.Filter) {
+		conn.Logger().Debugf("Server list ping does not match the filter")
+		return nil
+	}
+	priority := 1
+	if p.Filter.IsEmpty() {
+		priority = 0
+	}
+	// Pings are answered even when the remote is full, since they do not tie it up
+	if err = conn.RequireExclusive(priority); err != nil {
+		return err
+	}
+	if p.Action.MOTD == nil {
+		return framework.Proxy(conn, *p.Action.Remote, recorder.Data)
+	}
+	var response string
+	if legacy {
+		response = fmt.Sprintf("%s§%d§%d", *p.Action.MOTD, 0, 0)
+	} else {
+		if version < 0 {
+			// 1.4 and 1.5 do not send their version, so report one that no client will match
+			version = 127
+		}
+		versionName := ""
+		for i, v := range p.Filter.Version {
+			if v == Version(version) {
+				versionName = p.Filter.VersionName[i]
+			}
+		}
+		if versionName == "" {
+			var ok bool
+			if versionName, ok = PreNettyVersionNames[Version(version)]; !ok {
+				versionName = "unknown"
+			}
+		}
+		response = strings.Join([]string{"§1", strconv.Itoa(version), versionName, *p.Action.MOTD, "0", "0"}, "\x00")
+	}
+	if err = writer.WriteUByte(0xFF); err != nil {
+		return err
+	}
+	if err = writer.WriteUTF16String(response); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// pingContinues determines if the client sent more of the server list ping before the read deadline
+func pingContinues(stream *bufio.Reader) (bool, error) {
+	if _, err := stream.Peek(1); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
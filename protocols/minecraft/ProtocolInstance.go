@@ -2,6 +2,9 @@ package minecraft
 
 import (
 	"bufio"
+	"bytes"
+	"io"
+	"time"
 
 	"github.com/zachdeibert/protomux/framework"
 )
@@ -10,28 +13,90 @@ import (
 type ProtocolInstance struct {
 	Action ActionProps
 	Filter FilteringProps
+	Status *StatusCache
 }
 
 // CreateProtocolInstance creates a new ProtocolInstance
 func CreateProtocolInstance(action ActionProps, filter FilteringProps) *ProtocolInstance {
-	return &ProtocolInstance{
+	inst := &ProtocolInstance{
 		Action: action,
 		Filter: filter,
+		Status: nil,
 	}
+	if action.StatusCacheTTL > 0 {
+		inst.Status = CreateStatusCache(action.StatusCacheTTL)
+	}
+	return inst
 }
 
 // Handle the protocol
 func (p ProtocolInstance) Handle(conn framework.Connection) error {
-	stream := bufio.NewReader(conn)
+	recorder := framework.CreateRecorder(conn)
+	stream := bufio.NewReader(recorder)
 	data, err := stream.Peek(1)
 	if err != nil {
 		return err
 	}
 	if data[0] == 0xFE {
 		// Before Netty rewrite
-		// TODO
-		return ErrorProtocol("Before Netty rewrite not supported")
+		return p.HandlePreNettyRewrite(conn, stream, recorder)
 	}
 	// After Netty rewrite
-	return p.HandleNettyRewrite(conn, stream)
+	return p.HandleNettyRewrite(conn, stream, recorder)
+}
+
+// Match determines if the handshake received so far is for this server
+func (p ProtocolInstance) Match(prefix []byte) framework.ProtocolState {
+	return p.match(prefix, false)
+}
+
+// IdleTimeout gets how long to wait for the rest of a server list ping from before the Netty rewrite
+func (p ProtocolInstance) IdleTimeout() time.Duration {
+	return legacyPingWait
+}
+
+// MatchIdle determines if the handshake is for this server once the client has stopped sending
+func (p ProtocolInstance) MatchIdle(prefix []byte) framework.ProtocolState {
+	return p.match(prefix, true)
+}
+
+// match determines if the handshake is for this server, treating a short server list ping as complete if the client is idle
+func (p ProtocolInstance) match(prefix []byte, idle bool) framework.ProtocolState {
+	if len(prefix) == 0 {
+		return framework.ProtocolNeedsMoreData
+	}
+	reader := CreateReader(bytes.NewReader(prefix))
+	var filterData FilteringProps
+	if prefix[0] == 0xFE {
+		// Before Netty rewrite, only 1.6 sends anything to filter on
+		if len(prefix) > 1 && prefix[1] != 1 {
+			return framework.ProtocolNotMatched
+		}
+		if len(prefix) <= 2 && !idle {
+			// Older clients stop here, but 1.6 may still send its plugin message
+			return framework.ProtocolNeedsMoreData
+		}
+		if len(prefix) > 2 {
+			reader.ReadUShort()
+			handshake, err := ReadPingHost(reader)
+			if err == io.EOF {
+				return framework.ProtocolNeedsMoreData
+			} else if err != nil {
+				return framework.ProtocolNotMatched
+			}
+			filterData = handshake.FilteringProps()
+		}
+	} else {
+		handshake, err := ReadHandshake(reader)
+		if err == io.EOF {
+			return framework.ProtocolNeedsMoreData
+		} else if err != nil {
+			return framework.ProtocolNotMatched
+		}
+		filterData = handshake.FilteringProps()
+	}
+	if !filterData.Check(p.Filter) {
+		return framework.ProtocolNotMatched
+	}
+	return framework.ProtocolMatched
 }
@@ -0,0 +1,61 @@
+package minecraft
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// pingHost creates the server list ping that 1.6 sends
+func pingHost(version uint8, host string, port uint32) []byte {
+	var buf bytes.Buffer
+	w := CreateWriter(&buf)
+	w.WriteUByte(0xFE)
+	w.WriteUByte(1)
+	w.WriteUByte(0xFA)
+	w.WriteUTF16String("MC|PingHost")
+	w.WriteUShort(uint16(7 + 2*len(host)))
+	w.WriteUByte(version)
+	w.WriteUTF16String(host)
+	w.WriteUInt(port)
+	w.Flush()
+	return buf.Bytes()
+}
+
+func TestMatchPreNettyRewrite(t *testing.T) {
+	unfiltered := ProtocolInstance{}
+	v1_6 := ProtocolInstance{
+		Filter: FilteringProps{
+			Version: []Version{78},
+		},
+	}
+	ping := pingHost(78, "play.example.com", 25565)
+	tests := []struct {
+		name   string
+		inst   ProtocolInstance
+		prefix []byte
+		want   framework.ProtocolState
+		idle   framework.ProtocolState
+	}{
+		{"beta", unfiltered, []byte{0xFE}, framework.ProtocolNeedsMoreData, framework.ProtocolMatched},
+		{"1.4", unfiltered, []byte{0xFE, 0x01}, framework.ProtocolNeedsMoreData, framework.ProtocolMatched},
+		{"partial 1.6", unfiltered, ping[:10], framework.ProtocolNeedsMoreData, framework.ProtocolNeedsMoreData},
+		{"1.6", unfiltered, ping, framework.ProtocolMatched, framework.ProtocolMatched},
+		{"bad payload", unfiltered, []byte{0xFE, 0x02}, framework.ProtocolNotMatched, framework.ProtocolNotMatched},
+		{"not a plugin message", unfiltered, []byte{0xFE, 0x01, 0x00}, framework.ProtocolNotMatched, framework.ProtocolNotMatched},
+		{"filtered beta", v1_6, []byte{0xFE}, framework.ProtocolNeedsMoreData, framework.ProtocolNotMatched},
+		{"filtered 1.6", v1_6, ping, framework.ProtocolMatched, framework.ProtocolMatched},
+		{"filtered other version", v1_6, pingHost(74, "play.example.com", 25565), framework.ProtocolNotMatched, framework.ProtocolNotMatched},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.inst.Match(test.prefix); got != test.want {
+				t.Errorf("Match(% x) = %d, want %d", test.prefix, got, test.want)
+			}
+			if got := test.inst.MatchIdle(test.prefix); got != test.idle {
+				t.Errorf("MatchIdle(% x) = %d, want %d", test.prefix, got, test.idle)
+			}
+		})
+	}
+}
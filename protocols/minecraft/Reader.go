@@ -3,8 +3,15 @@ package minecraft
 import (
 	"bytes"
 	"io"
+	"unicode/utf16"
 )
 
+// maxPacketLength is the largest packet length a VarInt length prefix is allowed to hold
+const maxPacketLength = 2097151
+
+// maxVarIntBits is how many bits of payload the longest VarInt (five bytes) can hold
+const maxVarIntBits = 35
+
 // Reader reads primitives from the Minecraft protocol
 type Reader struct {
 	Base io.Reader
@@ -23,6 +30,9 @@ func (r *Reader) ReadVarInt() (int, error) {
 	res := 0
 	bitPos := 0
 	for (buf[0] & 0x80) != 0 {
+		if bitPos >= maxVarIntBits {
+			return 0, ErrorProtocol("VarInt is too long")
+		}
 		if _, err := r.Base.Read(buf); err != nil {
 			return 0, err
 		}
@@ -34,10 +44,23 @@ func (r *Reader) ReadVarInt() (int, error) {
 
 // ReadString reads a string
 func (r *Reader) ReadString() (string, error) {
+	return r.ReadBoundedString(maxPacketLength)
+}
+
+// ReadBoundedString reads a string that is at most max bytes long
+//
+// The length comes from the client, so it is checked against the bytes left in the packet before anything is allocated for it.
+func (r *Reader) ReadBoundedString(max int) (string, error) {
 	l, err := r.ReadVarInt()
 	if err != nil {
 		return "", err
 	}
+	if l < 0 || l > max {
+		return "", ErrorProtocol("Invalid string length")
+	}
+	if packet, ok := r.Base.(interface{ Len() int }); ok && l > packet.Len() {
+		return "", ErrorProtocol("String is longer than its packet")
+	}
 	buf := make([]byte, l)
 	it := buf
 	for len(it) > 0 {
@@ -50,6 +73,21 @@ func (r *Reader) ReadString() (string, error) {
 	return string(buf), nil
 }
 
+// ReadUTF16String reads a string that is encoded in UTF-16 with a short length prefix
+func (r *Reader) ReadUTF16String() (string, error) {
+	l, err := r.ReadUShort()
+	if err != nil {
+		return "", err
+	}
+	chars := make([]uint16, l)
+	for i := range chars {
+		if chars[i], err = r.ReadUShort(); err != nil {
+			return "", err
+		}
+	}
+	return string(utf16.Decode(chars)), nil
+}
+
 // ReadUByte reads an unsigned byte
 func (r *Reader) ReadUByte() (uint8, error) {
 	buf := []byte{0}
@@ -108,6 +146,9 @@ func (r *Reader) ReadUncompressedPacket() (*Reader, int, error) {
 	if err != nil {
 		return nil, 0, err
 	}
+	if l-((id>>7)+1) < 0 || l > maxPacketLength {
+		return nil, 0, ErrorProtocol("Invalid packet length")
+	}
 	buf := make([]byte, l-((id>>7)+1))
 	it := buf
 	for len(it) > 0 {
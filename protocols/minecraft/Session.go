@@ -0,0 +1,222 @@
+package minecraft
+
+import (
+	"bytes"
+	"compress/zlib"
+	"sync"
+
+	"github.com/zachdeibert/protomux/framework"
+)
+
+const (
+	// sessionLogin is the state of a Session until the backend accepts the login
+	sessionLogin = iota
+	// sessionPlay is the state of a Session once the client has joined the game
+	sessionPlay = iota
+	// sessionOpaque is the state of a Session that can no longer be followed, because it is encrypted or does not parse
+	sessionOpaque = iota
+)
+
+// playDisconnectIDs are the IDs of the disconnect packet in the play state, for the releases whose IDs are known
+var playDisconnectIDs = []struct {
+	From Version
+	To   Version
+	ID   int
+}{
+	{4, 5, 0x40},
+	{47, 47, 0x40},
+	{107, 340, 0x1A},
+	{393, 404, 0x1B},
+	{477, 498, 0x1A},
+	{573, 578, 0x1B},
+	{735, 736, 0x1A},
+}
+
+// Session follows the packets that a backend sends to a proxied client, so that a disconnect packet can be slipped in between two of them
+//
+// Once the backend turns on encryption the stream cannot be followed any more, so the client cannot be told anything.
+type Session struct {
+	framework.Connection
+	Version Version
+	State   int
+	// Threshold is the packet size from which the backend compresses packets, or -1 if compression is off
+	Threshold int
+	Pending   []byte
+	Mutex     sync.Mutex
+}
+
+// CreateSession creates a new Session for a client that is logging in
+func CreateSession(conn framework.Connection, version Version) *Session {
+	return &Session{
+		Connection: conn,
+		Version:    version,
+		State:      sessionLogin,
+		Threshold:  -1,
+		Pending:    nil,
+	}
+}
+
+// Write forwards the whole packets from the backend to the client, holding back the start of a packet until the rest of it arrives
+func (s *Session) Write(b []byte) (int, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if s.State == sessionOpaque {
+		return s.Connection.Write(b)
+	}
+	s.Pending = append(s.Pending, b...)
+	off := 0
+	for s.State != sessionOpaque {
+		n := s.frameLength(s.Pending[off:])
+		if n == 0 {
+			break
+		}
+		s.follow(s.Pending[off : off+n])
+		off += n
+	}
+	if s.State == sessionOpaque {
+		// Whatever is left is passed on as it is
+		off = len(s.Pending)
+	}
+	if off > 0 {
+		if _, err := s.Connection.Write(s.Pending[:off]); err != nil {
+			return 0, err
+		}
+	}
+	if off == len(s.Pending) {
+		s.Pending = nil
+	} else {
+		s.Pending = append([]byte{}, s.Pending[off:]...)
+	}
+	return len(b), nil
+}
+
+// CloseWrite shuts down the writing side of the client socket
+func (s *Session) CloseWrite() error {
+	if cw, ok := s.Connection.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return s.Connection.Close()
+}
+
+// frameLength finds the length of the first packet in a buffer including its length prefix, or 0 if the packet is not complete yet
+func (s *Session) frameLength(buf []byte) int {
+	l := 0
+	for i := 0; i < len(buf); i++ {
+		if i*7 >= maxVarIntBits {
+			s.State = sessionOpaque
+			return 0
+		}
+		l |= int(buf[i]&0x7F) << uint(i*7)
+		if buf[i]&0x80 == 0 {
+			if l > maxPacketLength {
+				s.State = sessionOpaque
+				return 0
+			}
+			if len(buf) < i+1+l {
+				return 0
+			}
+			return i + 1 + l
+		}
+	}
+	return 0
+}
+
+// follow updates the state of the Session from a packet that the backend sent
+func (s *Session) follow(frame []byte) {
+	reader := CreateReader(bytes.NewReader(frame))
+	if _, err := reader.ReadVarInt(); err != nil {
+		s.State = sessionOpaque
+		return
+	}
+	if s.Threshold >= 0 {
+		size, err := reader.ReadVarInt()
+		if err != nil {
+			s.State = sessionOpaque
+			return
+		}
+		if size != 0 {
+			z, err := zlib.NewReader(reader.Base)
+			if err != nil {
+				s.State = sessionOpaque
+				return
+			}
+			defer z.Close()
+			reader = CreateReader(z)
+		}
+	}
+	id, err := reader.ReadVarInt()
+	if err != nil {
+		s.State = sessionOpaque
+		return
+	}
+	switch {
+	case s.State == sessionLogin && id == 0x01: // encryption request
+		s.State = sessionOpaque
+		break
+	case s.State == sessionLogin && id == 0x02: // login success
+		s.State = sessionPlay
+		break
+	case s.State == sessionLogin && id == 0x03, s.State == sessionPlay && s.Version == 47 && id == 0x46: // set compression
+		if s.Threshold, err = reader.ReadVarInt(); err != nil {
+			s.State = sessionOpaque
+		}
+		break
+	}
+}
+
+// Farewell sends the client a disconnect packet between two of the packets from the backend
+func (s *Session) Farewell(reason string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	id := -1
+	switch s.State {
+	case sessionLogin:
+		id = 0x00
+		break
+	case sessionPlay:
+		for _, r := range playDisconnectIDs {
+			if s.Version >= r.From && s.Version <= r.To {
+				id = r.ID
+			}
+		}
+		break
+	}
+	if id < 0 {
+		return ErrorProtocol("The session cannot be followed, so the client cannot be told why it is disconnected")
+	}
+	packet := &bytes.Buffer{}
+	writer := &Writer{
+		Base: packet,
+	}
+	writer.WriteVarInt(id)
+	writer.WriteChat(reason)
+	return s.writePacket(packet.Bytes())
+}
+
+// writePacket frames a packet the way that the backend has told the client to expect
+func (s *Session) writePacket(data []byte) error {
+	frame := &bytes.Buffer{}
+	body := &Writer{
+		Base: frame,
+	}
+	if s.Threshold >= 0 {
+		if len(data) >= s.Threshold {
+			compressed := &bytes.Buffer{}
+			z := zlib.NewWriter(compressed)
+			z.Write(data)
+			z.Close()
+			body.WriteVarInt(len(data))
+			data = compressed.Bytes()
+		} else {
+			body.WriteVarInt(0)
+		}
+	}
+	frame.Write(data)
+	out := &bytes.Buffer{}
+	(&Writer{
+		Base: out,
+	}).WriteVarInt(frame.Len())
+	out.Write(frame.Bytes())
+	_, err := s.Connection.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,94 @@
+package minecraft
+
+import (
+	"sync"
+	"time"
+)
+
+// StatusCacheKey identifies what a status response was requested for, since a remote can answer differently for each version and address
+type StatusCacheKey struct {
+	Version Version
+	Address string
+	Port    uint16
+}
+
+// StatusCacheEntry is a single status response stored in a StatusCache, or the fetch of one that is still in progress
+type StatusCacheEntry struct {
+	Status  string
+	Err     error
+	Expires time.Time
+	// Done is closed once the status has been fetched
+	Done chan struct{}
+}
+
+// StatusCache stores the status responses from a remote server so repeated pings do not reach the server
+type StatusCache struct {
+	TTL     time.Duration
+	Entries map[StatusCacheKey]*StatusCacheEntry
+	Mutex   sync.Mutex
+}
+
+// CreateStatusCache creates a new StatusCache
+func CreateStatusCache(ttl time.Duration) *StatusCache {
+	return &StatusCache{
+		TTL:     ttl,
+		Entries: map[StatusCacheKey]*StatusCacheEntry{},
+	}
+}
+
+// Get returns the cached status response for a key, calling fetch if there is no fresh response cached
+//
+// Pings that arrive while the status is being fetched wait for that fetch instead of starting their own.
+func (c *StatusCache) Get(key StatusCacheKey, fetch func() (string, error)) (string, error) {
+	c.Mutex.Lock()
+	if entry, ok := c.Entries[key]; ok {
+		select {
+		case <-entry.Done:
+			if time.Now().Before(entry.Expires) {
+				c.Mutex.Unlock()
+				return entry.Status, nil
+			}
+			break
+		default:
+			c.Mutex.Unlock()
+			<-entry.Done
+			return entry.Status, entry.Err
+		}
+	}
+	c.prune()
+	entry := &StatusCacheEntry{
+		Done: make(chan struct{}),
+	}
+	c.Entries[key] = entry
+	c.Mutex.Unlock()
+	status, err := fetch()
+	c.Mutex.Lock()
+	entry.Status = status
+	entry.Err = err
+	entry.Expires = time.Now().Add(c.TTL)
+	if err != nil {
+		// Failures are only shared with the pings that were already waiting, so the next ping tries again
+		delete(c.Entries, key)
+	}
+	close(entry.Done)
+	c.Mutex.Unlock()
+	return status, err
+}
+
+// prune removes the responses that have expired, since clients can ask for any address
+//
+// The caller must hold the Mutex.
+func (c *StatusCache) prune() {
+	now := time.Now()
+	for key, entry := range c.Entries {
+		select {
+		case <-entry.Done:
+			if !now.Before(entry.Expires) {
+				delete(c.Entries, key)
+			}
+			break
+		default:
+			break
+		}
+	}
+}
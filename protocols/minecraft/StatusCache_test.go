@@ -0,0 +1,97 @@
+package minecraft
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusCacheSharesFetch(t *testing.T) {
+	cache := CreateStatusCache(time.Minute)
+	key := StatusCacheKey{
+		Version: 736,
+		Address: "play.example.com",
+		Port:    25565,
+	}
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func() (string, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return "status", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, err := cache.Get(key, fetch); status != "status" || err != nil {
+				t.Errorf("Get() = %q, %v", status, err)
+			}
+		}()
+	}
+	// Give every goroutine the chance to find the fetch in progress
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("fetched %d times, want 1", fetches)
+	}
+}
+
+func TestStatusCacheKeys(t *testing.T) {
+	cache := CreateStatusCache(time.Minute)
+	keys := []StatusCacheKey{
+		{Version: 736, Address: "a.example.com", Port: 25565},
+		{Version: 736, Address: "b.example.com", Port: 25565},
+		{Version: 736, Address: "a.example.com", Port: 25566},
+		{Version: 735, Address: "a.example.com", Port: 25565},
+	}
+	for i, key := range keys {
+		want := key.Address
+		if status, _ := cache.Get(key, func() (string, error) { return want, nil }); status != want {
+			t.Errorf("Get(%v) = %q, want %q", key, status, want)
+		}
+		if len(cache.Entries) != i+1 {
+			t.Errorf("cache has %d entries, want %d", len(cache.Entries), i+1)
+		}
+	}
+	if status, _ := cache.Get(keys[0], func() (string, error) { return "refetched", nil }); status != keys[0].Address {
+		t.Errorf("Get() = %q, want the cached %q", status, keys[0].Address)
+	}
+}
+
+func TestStatusCacheRetriesFailures(t *testing.T) {
+	cache := CreateStatusCache(time.Minute)
+	key := StatusCacheKey{
+		Version: 736,
+	}
+	if _, err := cache.Get(key, func() (string, error) { return "", errors.New("unreachable") }); err == nil {
+		t.Fatal("Get() did not return the fetch error")
+	}
+	if status, err := cache.Get(key, func() (string, error) { return "status", nil }); status != "status" || err != nil {
+		t.Errorf("Get() = %q, %v, want a new fetch", status, err)
+	}
+}
+
+func TestStatusCacheExpires(t *testing.T) {
+	cache := CreateStatusCache(time.Millisecond)
+	first := StatusCacheKey{
+		Address: "a.example.com",
+	}
+	second := StatusCacheKey{
+		Address: "b.example.com",
+	}
+	cache.Get(first, func() (string, error) { return "old", nil })
+	time.Sleep(5 * time.Millisecond)
+	if status, _ := cache.Get(first, func() (string, error) { return "new", nil }); status != "new" {
+		t.Errorf("Get() = %q, want the expired status to be fetched again", status)
+	}
+	time.Sleep(5 * time.Millisecond)
+	cache.Get(second, func() (string, error) { return "other", nil })
+	if _, ok := cache.Entries[first]; ok {
+		t.Error("expired entry was not pruned")
+	}
+}
@@ -908,6 +908,77 @@ var PreNettyRewriteVersions = map[string]Version{
 	"Beta 1.8-pre1": 15,
 }
 
+// PreNettyVersionNames contains the names of the earliest version using a specific protocol number before the Netty rewrite
+var PreNettyVersionNames = map[Version]string{
+	80: "13w39a",
+	79: "13w38a",
+	78: "1.6.4",
+	77: "1.6.3-pre",
+	76: "13w37a",
+	75: "13w36a",
+	74: "1.6.2",
+	73: "1.6.1",
+	72: "13w26a",
+	71: "13w25a",
+	70: "13w24b",
+	69: "13w24a",
+	68: "13w23b",
+	67: "13w21a",
+	66: "13w19a",
+	65: "13w18a",
+	64: "13w17a",
+	63: "13w16b",
+	62: "13w16a",
+	61: "1.5.2",
+	92: "2.0: Purple",
+	91: "2.0: Red",
+	90: "2.0: Blue",
+	60: "13w09c",
+	59: "13w09a",
+	58: "1.4.3-pre",
+	57: "13w05b",
+	56: "13w05a",
+	55: "13w04a",
+	54: "13w03a",
+	53: "13w02a",
+	52: "13w01a",
+	51: "12w50a",
+	50: "12w49a",
+	49: "1.4.4",
+	47: "1.4.2",
+	46: "12w41a",
+	45: "12w40b",
+	44: "12w40a",
+	43: "12w38a",
+	42: "12w34b",
+	41: "12w34a",
+	40: "12w32a",
+	39: "12w30c",
+	38: "12w27a",
+	37: "12w25a",
+	36: "12w24a",
+	35: "12w23a",
+	34: "12w22a",
+	33: "12w21a",
+	32: "12w18a",
+	31: "12w17a",
+	30: "12w16a",
+	29: "1.2.4",
+	28: "12w08a",
+	27: "12w07a",
+	25: "12w06a",
+	24: "12w03a",
+	23: "12w01a",
+	22: "Beta 1.9-pre6",
+	21: "Beta 1.9-pre5",
+	20: "Beta 1.9-pre4",
+	19: "Beta 1.9-pre2",
+	18: "Beta 1.9-pre1",
+	17: "Beta 1.8",
+	16: "Beta 1.8-pre2",
+	15: "Beta 1.8-pre1",
+}
+
 // ParseVersion parses a version string
 func ParseVersion(version string) (Version, error) {
 	if val, ok := NettyRewriteVersions[version]; ok {
@@ -3,7 +3,9 @@ package minecraft
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"io"
+	"unicode/utf16"
 )
 
 // Writer writes primitives to the Minecraft protocol
@@ -57,6 +59,31 @@ func (w *Writer) WriteString(val string) error {
 	return nil
 }
 
+// WriteChat writes a chat message that is only plain text
+func (w *Writer) WriteChat(text string) error {
+	data, err := json.Marshal(map[string]string{
+		"text": text,
+	})
+	if err != nil {
+		return err
+	}
+	return w.WriteString(string(data))
+}
+
+// WriteUTF16String writes a string that is encoded in UTF-16 with a short length prefix
+func (w *Writer) WriteUTF16String(val string) error {
+	chars := utf16.Encode([]rune(val))
+	if err := w.WriteUShort(uint16(len(chars))); err != nil {
+		return err
+	}
+	for _, c := range chars {
+		if err := w.WriteUShort(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // WriteUByte writes an unsigned byte
 func (w *Writer) WriteUByte(val uint8) error {
 	_, err := w.Base.Write([]byte{val})
@@ -0,0 +1,74 @@
+package passthrough
+
+import (
+	"fmt"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/config/common"
+)
+
+// ErrorCode describes a specific error
+type ErrorCode int
+
+const (
+	// ErrorCodeMultipleValues represents when a property that should have only had one value has multiple
+	ErrorCodeMultipleValues ErrorCode = iota
+	// ErrorCodeParameterRequirement represents when a requirement for a parameter is not met
+	ErrorCodeParameterRequirement ErrorCode = iota
+	// ErrorCodeUnrecognizedParameter represents when a parameter name is not recognized
+	ErrorCodeUnrecognizedParameter ErrorCode = iota
+	// ErrorCodeUnknownRemoteType represents when an unknown remote type is specified
+	ErrorCodeUnknownRemoteType ErrorCode = iota
+	// ErrorCodeResolve represents when the address of a remote cannot be resolved
+	ErrorCodeResolve ErrorCode = iota
+)
+
+// Error describes an error with the passthrough protocol implementation
+type Error struct {
+	Message string
+	Code    ErrorCode
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// ErrorMultipleValues creates a new ErrorMultipleValues error
+func ErrorMultipleValues(param string) error {
+	return &Error{
+		Message: fmt.Sprintf("Parameter '%s' can only have one value, but has an array", param),
+		Code:    ErrorCodeMultipleValues,
+	}
+}
+
+// ErrorParameterRequirement creates a new ErrorParameterRequirement error
+func ErrorParameterRequirement(message string) error {
+	return &Error{
+		Message: message,
+		Code:    ErrorCodeParameterRequirement,
+	}
+}
+
+// ErrorUnrecognizedParameter creates a new ErrorUnrecognizedParameter error
+func ErrorUnrecognizedParameter(name string, location common.Location) error {
+	return &Error{
+		Message: fmt.Sprintf("Unrecognized parameter '%s' (at %s)\n%s", name, location.ShortString(), location),
+		Code:    ErrorCodeUnrecognizedParameter,
+	}
+}
+
+// ErrorUnknownRemoteType creates a new ErrorUnknownRemoteType error
+func ErrorUnknownRemoteType(name string) error {
+	return &Error{
+		Message: fmt.Sprintf("Unrecognized remote type '%s'", name),
+		Code:    ErrorCodeUnknownRemoteType,
+	}
+}
+
+// ErrorResolve creates a new ErrorResolve error
+func ErrorResolve(remote config.Connection, err error) error {
+	return &Error{
+		Message: fmt.Sprintf("Unable to resolve %s: %s", remote, err),
+		Code:    ErrorCodeResolve,
+	}
+}
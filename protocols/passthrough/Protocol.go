@@ -0,0 +1,79 @@
+package passthrough
+
+import (
+	"net"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// Protocol implementation that forwards connections and datagram flows to a remote without understanding them
+type Protocol struct {
+}
+
+// Configure the protocol
+func (p Protocol) Configure(globals config.Parameters, remoteName string, remoteParams config.Parameters) (framework.ProtocolInstance, error) {
+	for k, v := range globals.Locations {
+		return nil, ErrorUnrecognizedParameter(k, v)
+	}
+	var remote *config.Connection
+	var prefix []byte
+	for k, v := range remoteParams.Locations {
+		switch k {
+		case "remote":
+			vals, ok := remoteParams.Connections[k]
+			if !ok {
+				return nil, ErrorUnrecognizedParameter(k, v)
+			}
+			if len(vals) > 1 {
+				return nil, ErrorMultipleValues(k)
+			}
+			remote = &vals[0]
+			break
+		case "prefix":
+			vals, ok := remoteParams.Strings[k]
+			if !ok {
+				return nil, ErrorUnrecognizedParameter(k, v)
+			}
+			if len(vals) > 1 {
+				return nil, ErrorMultipleValues(k)
+			}
+			prefix = []byte(vals[0])
+			break
+		default:
+			return nil, ErrorUnrecognizedParameter(k, v)
+		}
+	}
+	if remote == nil {
+		return nil, ErrorParameterRequirement("'remote' must be specified on every remote")
+	}
+	switch remoteName {
+	case "server":
+		if len(prefix) == 0 {
+			return nil, ErrorParameterRequirement("There must be a 'prefix' on every server")
+		}
+		break
+	case "default":
+		if prefix != nil {
+			return nil, ErrorParameterRequirement("The default server cannot have a 'prefix'")
+		}
+		break
+	default:
+		return nil, ErrorUnknownRemoteType(remoteName)
+	}
+	var backend *net.UDPAddr
+	if len(remote.Network) == 0 {
+		// Resolving the address now keeps DNS lookups out of the loop that receives datagrams
+		_, address := remote.Dialable()
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			return nil, ErrorResolve(*remote, err)
+		}
+		backend = addr
+	}
+	return CreateProtocolInstance(prefix, *remote, backend), nil
+}
+
+func init() {
+	framework.RegisterProtocol("passthrough", &Protocol{})
+}
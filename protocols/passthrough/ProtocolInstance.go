@@ -0,0 +1,69 @@
+package passthrough
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// ProtocolInstance implementation for the passthrough protocol
+type ProtocolInstance struct {
+	// Prefix is what connections and flows have to start with, or empty to match all of them
+	Prefix []byte
+	Remote config.Connection
+	// Backend is where datagram flows are forwarded to, or nil if the Remote cannot receive them
+	Backend *net.UDPAddr
+}
+
+// CreateProtocolInstance creates a new ProtocolInstance
+func CreateProtocolInstance(prefix []byte, remote config.Connection, backend *net.UDPAddr) *ProtocolInstance {
+	return &ProtocolInstance{
+		Prefix:  prefix,
+		Remote:  remote,
+		Backend: backend,
+	}
+}
+
+// Handle the protocol
+func (p ProtocolInstance) Handle(conn framework.Connection) error {
+	priority := 1
+	if len(p.Prefix) == 0 {
+		priority = 0
+	}
+	if err := conn.RequireExclusive(priority); err != nil {
+		return err
+	}
+	if err := conn.AcquireSlot(); err == framework.ErrorRemoteFull {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// The prefix has not been consumed, so it is forwarded along with everything after it
+	return framework.Proxy(conn, p.Remote, nil)
+}
+
+// Match determines if the data received so far starts with the prefix
+func (p ProtocolInstance) Match(prefix []byte) framework.ProtocolState {
+	if len(prefix) < len(p.Prefix) {
+		if bytes.HasPrefix(p.Prefix, prefix) {
+			return framework.ProtocolNeedsMoreData
+		}
+		return framework.ProtocolNotMatched
+	}
+	if bytes.HasPrefix(prefix, p.Prefix) {
+		return framework.ProtocolMatched
+	}
+	return framework.ProtocolNotMatched
+}
+
+// MatchDatagram determines if the first datagram of a flow starts with the prefix
+func (p ProtocolInstance) MatchDatagram(datagram []byte) bool {
+	return p.Backend != nil && bytes.HasPrefix(datagram, p.Prefix)
+}
+
+// DatagramBackend gets the address that matched flows are forwarded to
+func (p ProtocolInstance) DatagramBackend() *net.UDPAddr {
+	return p.Backend
+}
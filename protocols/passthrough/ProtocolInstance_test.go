@@ -0,0 +1,148 @@
+package passthrough
+
+import (
+	"net"
+	"testing"
+
+	"github.com/zachdeibert/protomux/config"
+	"github.com/zachdeibert/protomux/config/common"
+	"github.com/zachdeibert/protomux/framework"
+)
+
+// parameters creates the Parameters of a remote with a remote address and an optional prefix
+func parameters(remote *config.Connection, prefix *string) config.Parameters {
+	params := config.Parameters{
+		Strings:     map[string][]string{},
+		Connections: map[string][]config.Connection{},
+		Booleans:    map[string][]bool{},
+		Integers:    map[string][]int{},
+		Locations:   map[string]common.Location{},
+	}
+	if remote != nil {
+		params.Connections["remote"] = []config.Connection{*remote}
+		params.Locations["remote"] = common.Location{}
+	}
+	if prefix != nil {
+		params.Strings["prefix"] = []string{*prefix}
+		params.Locations["prefix"] = common.Location{}
+	}
+	return params
+}
+
+func TestConfigure(t *testing.T) {
+	remote := &config.Connection{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: 25581,
+	}
+	unix := &config.Connection{
+		Network: "unix",
+		Path:    "/run/backend.sock",
+	}
+	prefix := "SSH-"
+	empty := ""
+	tests := []struct {
+		name       string
+		remoteName string
+		remote     *config.Connection
+		prefix     *string
+		backend    string
+		code       ErrorCode
+	}{
+		{"default", "default", remote, nil, "127.0.0.1:25581", -1},
+		{"server", "server", remote, &prefix, "127.0.0.1:25581", -1},
+		{"unix", "default", unix, nil, "", -1},
+		{"no remote", "default", nil, nil, "", ErrorCodeParameterRequirement},
+		{"server without prefix", "server", remote, nil, "", ErrorCodeParameterRequirement},
+		{"server with empty prefix", "server", remote, &empty, "", ErrorCodeParameterRequirement},
+		{"default with prefix", "default", remote, &prefix, "", ErrorCodeParameterRequirement},
+		{"unknown remote type", "client", remote, nil, "", ErrorCodeUnknownRemoteType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inst, err := Protocol{}.Configure(parameters(nil, nil), test.remoteName, parameters(test.remote, test.prefix))
+			if test.code >= 0 {
+				if e, ok := err.(*Error); !ok || e.Code != test.code {
+					t.Fatalf("Configure() error = %v, want code %d", err, test.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Configure() error = %v", err)
+			}
+			backend := inst.(framework.DatagramHandler).DatagramBackend()
+			if test.backend == "" {
+				if backend != nil {
+					t.Errorf("DatagramBackend() = %s, want nil", backend)
+				}
+			} else if backend == nil || backend.String() != test.backend {
+				t.Errorf("DatagramBackend() = %s, want %s", backend, test.backend)
+			}
+		})
+	}
+}
+
+func TestConfigureRejectsGlobals(t *testing.T) {
+	remote := &config.Connection{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: 25581,
+	}
+	_, err := Protocol{}.Configure(parameters(remote, nil), "default", parameters(remote, nil))
+	if e, ok := err.(*Error); !ok || e.Code != ErrorCodeUnrecognizedParameter {
+		t.Fatalf("Configure() error = %v, want code %d", err, ErrorCodeUnrecognizedParameter)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		data   string
+		want   framework.ProtocolState
+	}{
+		{"default before data", "", "", framework.ProtocolMatched},
+		{"default", "", "anything", framework.ProtocolMatched},
+		{"nothing yet", "SSH-", "", framework.ProtocolNeedsMoreData},
+		{"partial prefix", "SSH-", "SS", framework.ProtocolNeedsMoreData},
+		{"exact prefix", "SSH-", "SSH-", framework.ProtocolMatched},
+		{"longer data", "SSH-", "SSH-2.0-OpenSSH", framework.ProtocolMatched},
+		{"wrong partial", "SSH-", "GE", framework.ProtocolNotMatched},
+		{"wrong data", "SSH-", "GET / HTTP/1.1", framework.ProtocolNotMatched},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inst := CreateProtocolInstance([]byte(test.prefix), config.Connection{}, nil)
+			if got := inst.Match([]byte(test.data)); got != test.want {
+				t.Errorf("Match(%q) = %d, want %d", test.data, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchDatagram(t *testing.T) {
+	backend := &net.UDPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: 25581,
+	}
+	tests := []struct {
+		name     string
+		prefix   string
+		backend  *net.UDPAddr
+		datagram string
+		want     bool
+	}{
+		{"default", "", backend, "anything", true},
+		{"empty datagram", "", backend, "", true},
+		{"prefix", "\xff\xff\xff\xff", backend, "\xff\xff\xff\xffgetstatus", true},
+		{"short datagram", "\xff\xff\xff\xff", backend, "\xff\xff", false},
+		{"wrong prefix", "\xff\xff\xff\xff", backend, "getstatus", false},
+		{"no backend", "", nil, "anything", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inst := CreateProtocolInstance([]byte(test.prefix), config.Connection{}, test.backend)
+			if got := inst.MatchDatagram([]byte(test.datagram)); got != test.want {
+				t.Errorf("MatchDatagram(%q) = %t, want %t", test.datagram, got, test.want)
+			}
+		})
+	}
+}